@@ -0,0 +1,227 @@
+package main
+
+import (
+	"strings"
+)
+
+// Parser states.
+const (
+	parseGround    = iota
+	parseEsc       // after ESC
+	parseCSI       // inside ESC [ … final
+	parseEscInter  // ESC plus intermediates, e.g. ESC ( B
+	parseString    // OSC, DCS, SOS, PM or APC body
+	parseStringEsc // ESC inside a string: ST if '\' follows
+)
+
+// maxCSIParams bounds the parameters buffered from one CSI sequence; a
+// longer one is parsed through but ignored.
+const maxCSIParams = 256
+
+// What feed reports a byte completed.
+const (
+	ansiNone  = iota
+	ansiCSI   // a CSI sequence: kind, params and the byte fed say which
+	ansiReset // RIS (ESC c): the terminal's full reset
+)
+
+// ansiState follows output byte by byte through escape sequences and
+// keeps the SGR attributes in effect. It is the one parser for terminal
+// output: the ring runs one over the bytes it evicts, so it knows the
+// state its oldest byte was written in, and modeTracker acts on the
+// sequences one reports.
+type ansiState struct {
+	state  int
+	kind   byte   // 0 for a plain CSI, '?' for DEC private, 'x' for anything else
+	params []byte // the CSI's parameter bytes: digits, ':' and ';'
+	sgr    sgrState
+}
+
+// feed advances the parser over one byte and reports the sequence it
+// completed, if any. For ansiCSI, a.kind and a.params describe the
+// sequence until the next byte is fed.
+func (a *ansiState) feed(b byte) int {
+	switch a.state {
+	case parseGround:
+		if b == 0x1b {
+			a.state = parseEsc
+		}
+	case parseEsc:
+		switch {
+		case b == '[':
+			a.state, a.kind, a.params = parseCSI, 0, a.params[:0]
+		case b == ']' || b == 'P' || b == 'X' || b == '^' || b == '_':
+			a.state = parseString
+		case b == 'c':
+			a.sgr = sgrState{}
+			a.state = parseGround
+			return ansiReset
+		case b >= 0x20 && b <= 0x2f:
+			a.state = parseEscInter
+		case b == 0x1b:
+		default:
+			a.state = parseGround
+		}
+	case parseEscInter:
+		if b >= 0x30 && b <= 0x7e {
+			a.state = parseGround
+		} else if b == 0x1b {
+			a.state = parseEsc
+		}
+	case parseCSI:
+		switch {
+		case b >= 0x40 && b <= 0x7e: // final byte
+			a.state = parseGround
+			if len(a.params) >= maxCSIParams {
+				return ansiNone
+			}
+			if a.kind == 0 && b == 'm' {
+				a.sgr.apply(string(a.params))
+			}
+			return ansiCSI
+		case b >= '0' && b <= ';': // digits, ':' and ';'
+			if len(a.params) < maxCSIParams {
+				a.params = append(a.params, b)
+			}
+		case b == '?' && len(a.params) == 0 && a.kind == 0:
+			a.kind = '?'
+		case b == 0x1b:
+			a.state = parseEsc
+		case b < 0x20:
+			// C0 controls are executed mid-sequence; keep parsing.
+		default:
+			// Intermediate bytes or another private marker: some other
+			// kind of sequence, which is parsed through but ignored.
+			a.kind = 'x'
+		}
+	case parseString:
+		switch b {
+		case 0x07: // BEL ends an OSC, as xterm allows
+			a.state = parseGround
+		case 0x1b:
+			a.state = parseStringEsc
+		}
+	case parseStringEsc:
+		if b == '\\' {
+			a.state = parseGround
+		} else {
+			a.state = parseString
+		}
+	}
+	return ansiNone
+}
+
+// clean reports whether output could start at next: outside any escape
+// sequence and not partway through a UTF-8 character.
+func (a *ansiState) clean(next byte) bool {
+	return a.state == parseGround && next&0xC0 != 0x80
+}
+
+// clone returns a copy that can be fed without disturbing a.
+func (a ansiState) clone() ansiState {
+	a.params = append([]byte(nil), a.params...)
+	return a
+}
+
+// sgrState is the set of SGR attributes in effect. Colours are kept as
+// the parameters that set them ("31", "38;5;208", "38:2::255:0:0").
+type sgrState struct {
+	attrs     [10]bool // 1 bold … 9 strikethrough; 4 is in underline
+	underline string   // "4", "4:3", "21", or "" for none
+	fg, bg    string
+	ulColor   string
+}
+
+// apply updates the state for one SGR sequence's parameters.
+func (s *sgrState) apply(params string) {
+	tokens := strings.Split(params, ";")
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		head, sub, colon := strings.Cut(tok, ":")
+		switch head {
+		case "", "0":
+			*s = sgrState{}
+		case "1", "2", "3", "5", "6", "7", "8", "9":
+			s.attrs[head[0]-'0'] = true
+		case "4":
+			if sub == "0" {
+				s.underline = ""
+			} else {
+				s.underline = tok
+			}
+		case "21":
+			s.underline = tok
+		case "22":
+			s.attrs[1], s.attrs[2] = false, false
+		case "23":
+			s.attrs[3] = false
+		case "24":
+			s.underline = ""
+		case "25":
+			s.attrs[5], s.attrs[6] = false, false
+		case "27":
+			s.attrs[7] = false
+		case "28":
+			s.attrs[8] = false
+		case "29":
+			s.attrs[9] = false
+		case "38", "48", "58":
+			color := tok
+			if !colon && i+1 < len(tokens) {
+				// Semicolon form: 5;n or 2;r;g;b follow as parameters.
+				n := 0
+				switch tokens[i+1] {
+				case "5":
+					n = 2
+				case "2":
+					n = 4
+				}
+				n = min(n, len(tokens)-1-i)
+				color = strings.Join(tokens[i:i+1+n], ";")
+				i += n
+			}
+			switch head {
+			case "38":
+				s.fg = color
+			case "48":
+				s.bg = color
+			default:
+				s.ulColor = color
+			}
+		case "39":
+			s.fg = ""
+		case "49":
+			s.bg = ""
+		case "59":
+			s.ulColor = ""
+		default:
+			switch {
+			case len(head) == 2 && (head[0] == '3' || head[0] == '9') && head[1] <= '7':
+				s.fg = head
+			case len(head) == 2 && head[0] == '4' && head[1] <= '7',
+				len(head) == 3 && head[:2] == "10" && head[2] <= '7':
+				s.bg = head
+			}
+		}
+	}
+}
+
+// sequence returns an SGR sequence that resets the terminal to this
+// state, or nil for the default state.
+func (s sgrState) sequence() []byte {
+	if s == (sgrState{}) {
+		return nil
+	}
+	parts := []string{"0"}
+	for n, on := range s.attrs {
+		if on {
+			parts = append(parts, string(rune('0'+n)))
+		}
+	}
+	for _, p := range []string{s.underline, s.fg, s.bg, s.ulColor} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return []byte("\x1b[" + strings.Join(parts, ";") + "m")
+}
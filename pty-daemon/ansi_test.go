@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestSGRState(t *testing.T) {
+	cases := []struct {
+		params []string
+		want   string
+	}{
+		{[]string{"1;31"}, "\x1b[0;1;31m"},
+		{[]string{"1;31", "22"}, "\x1b[0;31m"},
+		{[]string{"38;2;255;128;0;48;5;17"}, "\x1b[0;38;2;255;128;0;48;5;17m"},
+		{[]string{"38:2::255:128:0", "4:3", "58;5;9"}, "\x1b[0;4:3;38:2::255:128:0;58;5;9m"},
+		{[]string{"4", "24", "7", "27"}, ""},
+		{[]string{"93;104", "39"}, "\x1b[0;104m"},
+		{[]string{"1;3;4;31", ""}, ""},
+		{[]string{"38;5"}, "\x1b[0;38;5m"}, // truncated: kept, not a crash
+	}
+	for _, c := range cases {
+		var s sgrState
+		for _, p := range c.params {
+			s.apply(p)
+		}
+		if got := string(s.sequence()); got != c.want {
+			t.Errorf("%q: expected %q, got %q", c.params, c.want, got)
+		}
+	}
+}
+
+func TestANSIState_Clean(t *testing.T) {
+	var a ansiState
+	for _, b := range []byte("\x1b[1m\x1b]0;title\x1b\\\x1b(B") {
+		if a.state == parseGround && b != 0x1b {
+			t.Fatalf("left a sequence early at %q", b)
+		}
+		a.feed(b)
+	}
+	if !a.clean('x') || a.clean(0x80) {
+		t.Fatal("expected a clean point before ASCII, not before a continuation byte")
+	}
+	if string(a.sgr.sequence()) != "\x1b[0;1m" {
+		t.Fatalf("expected bold, got %q", a.sgr.sequence())
+	}
+}
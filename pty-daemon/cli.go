@@ -0,0 +1,597 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// request sends one message to the running daemon over a fresh connection
+// and decodes the first reply into out. A fresh connection isn't attached
+// to anything, so the first line back is always the reply.
+func request(msg interface{}, out interface{}) error {
+	conn, err := net.DialTimeout("unix", socketPath(), 2*time.Second)
+	if err != nil {
+		return fmt.Errorf("daemon not reachable: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if err := json.NewEncoder(conn).Encode(msg); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		return errors.New("daemon closed the connection")
+	}
+	var reply ErrorResponse
+	if err := json.Unmarshal(scanner.Bytes(), &reply); err != nil {
+		return err
+	}
+	if reply.Type == "error" {
+		return replyError(reply.Message)
+	}
+	return json.Unmarshal(scanner.Bytes(), out)
+}
+
+// replyError is an error the daemon answered with, as opposed to not
+// answering at all.
+type replyError string
+
+func (e replyError) Error() string { return string(e) }
+
+// fail prints an error for a CLI command and exits.
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
+
+// cmdPs prints a session's process tree: pty-daemon ps <session-id>
+func cmdPs(args []string) {
+	if len(args) != 1 {
+		fail("Usage: pty-daemon ps <session-id>")
+	}
+	var resp PsResponse
+	if err := request(PsRequest{Type: "ps", ID: args[0]}, &resp); err != nil {
+		fail("ps: %v", err)
+	}
+	fmt.Printf("%-8s %-8s %-5s %8s %8s  %s\n", "PID", "PGID", "STAT", "CPU", "RSS", "COMMAND")
+	for _, p := range resp.Processes {
+		stat := p.State
+		if p.Foreground {
+			stat += "+" // same marker ps uses for the foreground group
+		}
+		indent := ""
+		if p.Depth > 0 {
+			indent = strings.Repeat("  ", p.Depth-1) + "└─ "
+		}
+		fmt.Printf("%-8d %-8d %-5s %8s %8s  %s%s\n", p.Pid, p.Pgid, stat,
+			formatCPU(p.CPUMs), formatBytes(p.RSSBytes), indent, strings.Join(p.Command, " "))
+	}
+}
+
+func formatCPU(ms int64) string {
+	return (time.Duration(ms) * time.Millisecond).Truncate(10 * time.Millisecond).String()
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// cmdStats prints the daemon's stats as indented JSON: pty-daemon stats [session-id]
+func cmdStats(args []string) {
+	req := StatsRequest{Type: "stats"}
+	if len(args) > 0 {
+		req.ID = args[0]
+	}
+	var resp StatsResponse
+	if err := request(req, &resp); err != nil {
+		fail("stats: %v", err)
+	}
+	out, _ := json.MarshalIndent(resp, "", "  ")
+	fmt.Println(string(out))
+}
+
+// cmdLogs prints the daemon log, oldest first, optionally following it:
+// pty-daemon logs [-f] [--session id] [--client id] [--level warn]
+func cmdLogs(args []string) {
+	fs := flag.NewFlagSet("logs", flag.ExitOnError)
+	follow := fs.Bool("f", false, "keep printing new lines as they are written")
+	session := fs.String("session", "", "only lines about this session ID")
+	clientID := fs.String("client", "", "only lines about this client ID")
+	level := fs.String("level", "debug", "minimum level: debug, info, warn, error")
+	fs.Parse(args)
+
+	minLevel, err := parseLogLevel(*level)
+	if err != nil {
+		fail("logs: %v", err)
+	}
+	filter := logFilter{session: *session, client: *clientID, level: minLevel}
+	emit := func(line []byte) {
+		if out, ok := formatLogLine(line, filter); ok {
+			fmt.Println(out)
+		}
+	}
+
+	// Rotated files first, oldest to newest, then the live file.
+	for i := currentConfig().LogKeep; i >= 1; i-- {
+		if f, err := os.Open(rotatedLogPath(logPath(), i)); err == nil {
+			scanLines(f, emit)
+			f.Close()
+		}
+	}
+	f, err := os.Open(logPath())
+	if err != nil {
+		fail("logs: %v", err)
+	}
+	defer f.Close()
+	offset := scanLines(f, emit)
+	if !*follow {
+		return
+	}
+
+	for {
+		time.Sleep(250 * time.Millisecond)
+		// Stat the path before reading what we have open: if the log was
+		// rotated by then, nothing more goes to the old file, so reading it
+		// to the end now loses no lines.
+		fi, statErr := os.Stat(logPath())
+		offset += readFrom(f, offset, emit)
+		if statErr != nil {
+			continue // mid-rotation
+		}
+		if cur, err := f.Stat(); err == nil && os.SameFile(fi, cur) && fi.Size() >= offset {
+			continue
+		}
+		// Rotated or truncated: read the new file from the beginning.
+		next, err := os.Open(logPath())
+		if err != nil {
+			continue
+		}
+		f.Close()
+		f = next
+		offset = readFrom(f, 0, emit)
+	}
+}
+
+// readFrom calls emit for each complete line in f from offset on and
+// returns the bytes consumed.
+func readFrom(f *os.File, offset int64, emit func([]byte)) int64 {
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0
+	}
+	return scanLines(f, emit)
+}
+
+// scanLines calls emit for each complete line in r and returns the bytes
+// consumed. A trailing partial line is left for the next read.
+func scanLines(r io.Reader, emit func([]byte)) int64 {
+	br := bufio.NewReaderSize(r, 64*1024)
+	var consumed int64
+	for {
+		line, err := br.ReadBytes('\n')
+		if err != nil {
+			return consumed
+		}
+		consumed += int64(len(line))
+		emit(bytes.TrimRight(line, "\n"))
+	}
+}
+
+// cmdConfig validates the config file and prints the effective settings:
+// pty-daemon config check [path]
+func cmdConfig(args []string) {
+	if len(args) == 0 || args[0] != "check" {
+		fail("Usage: pty-daemon config check [path]")
+	}
+	path := configPath()
+	if len(args) > 1 {
+		path = args[1]
+	}
+	cfg, err := loadConfig(path)
+	if err != nil {
+		fail("Invalid config: %v", err)
+	}
+	out, _ := json.MarshalIndent(cfg, "", "  ")
+	fmt.Printf("%s is valid. Effective config:\n%s\n", path, out)
+}
+
+// cmdResurrect lists archived sessions, or respawns the given ones:
+// pty-daemon resurrect [session-id...]
+func cmdResurrect(args []string) {
+	if len(args) == 0 {
+		var resp ArchivedResponse
+		if err := request(ArchivedRequest{Type: "archived"}, &resp); err != nil {
+			fail("resurrect: %v", err)
+		}
+		fmt.Printf("%-24s %-20s %-8s %-19s %-30s %s\n", "ID", "NAME", "REASON", "ENDED", "CWD", "COMMAND")
+		for _, s := range resp.Sessions {
+			cwd := s.LastCwd
+			if cwd == "" {
+				cwd = s.Cwd
+			}
+			ended := time.UnixMilli(s.EndedAt).Format("2006-01-02 15:04:05")
+			fmt.Printf("%-24s %-20s %-8s %-19s %-30s %s\n", s.ID, s.Name, s.Reason, ended, cwd,
+				strings.Join(append([]string{s.Command}, s.Args...), " "))
+		}
+		return
+	}
+	failed := false
+	for _, id := range args {
+		var resp ResurrectedResponse
+		if err := request(ResurrectRequest{Type: "resurrect", ID: id}, &resp); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", id, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("%s: restored (pid %d, cwd %s)\n", resp.ID, resp.Pid, resp.Cwd)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// cmdList prints sessions, optionally only those matching a label selector:
+// pty-daemon list [-l selector]
+func cmdList(args []string) {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	selector := fs.String("l", "", `label selector, e.g. "project=web,!pinned"`)
+	fs.Parse(args)
+
+	var resp ListResponse
+	if err := request(ListRequest{Type: "list", Selector: *selector}, &resp); err != nil {
+		fail("list: %v", err)
+	}
+	sort.Slice(resp.Sessions, func(i, j int) bool { return resp.Sessions[i].StartedAt < resp.Sessions[j].StartedAt })
+	fmt.Printf("%-24s %-20s %-8s %-8s %s\n", "ID", "NAME", "STATE", "PID", "LABELS")
+	for _, s := range resp.Sessions {
+		state := "running"
+		if !s.Alive {
+			state = fmt.Sprintf("exit %d", s.ExitCode)
+		}
+		fmt.Printf("%-24s %-20s %-8s %-8d %s\n", s.ID, s.Name, state, s.Pid, formatLabels(s.Labels))
+	}
+}
+
+// formatLabels renders labels as sorted k=v pairs.
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// patchFlag collects repeated "key=value" (set) and "key-" (remove) flags
+// into a patch for UpdateRequest.
+type patchFlag map[string]*string
+
+func (p patchFlag) String() string { return "" }
+
+func (p patchFlag) Set(s string) error {
+	if k, v, ok := strings.Cut(s, "="); ok {
+		p[k] = &v
+		return nil
+	}
+	if k, ok := strings.CutSuffix(s, "-"); ok && k != "" {
+		p[k] = nil
+		return nil
+	}
+	return fmt.Errorf("want key=value or key-, got %q", s)
+}
+
+// cmdUpdate changes a session's name, labels or metadata:
+// pty-daemon update <session-id> [--name n] [--label k=v|k-]... [--meta k=v|k-]...
+func cmdUpdate(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fail("Usage: pty-daemon update <session-id> [--name n] [--label k=v|k-]... [--meta k=v|k-]...")
+	}
+	fs := flag.NewFlagSet("update", flag.ExitOnError)
+	name := fs.String("name", "", "display name")
+	labels, meta := patchFlag{}, patchFlag{}
+	fs.Var(labels, "label", "set (k=v) or remove (k-) a label; repeatable")
+	fs.Var(meta, "meta", "set (k=v) or remove (k-) a metadata key; repeatable")
+	fs.Parse(args[1:])
+
+	req := UpdateRequest{Type: "update", ID: args[0]}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "name" {
+			req.Name = name
+		}
+	})
+	if len(labels) > 0 {
+		req.Labels = labels
+	}
+	if len(meta) > 0 {
+		req.Metadata = meta
+	}
+	var resp UpdatedEvent
+	if err := request(req, &resp); err != nil {
+		fail("update: %v", err)
+	}
+	fmt.Printf("%s: name %q, labels %s\n", resp.ID, resp.Name, formatLabels(resp.Labels))
+}
+
+// cmdKeys sends keys by name: pty-daemon keys <session-id> <key>...
+// e.g. pty-daemon keys build C-c Up Enter
+func cmdKeys(args []string) {
+	if len(args) < 2 {
+		fail("Usage: pty-daemon keys <session-id> <key>...  (e.g. C-c, Up, F5, M-x, Enter)")
+	}
+	var resp SentResponse
+	if err := request(KeysRequest{Type: "keys", ID: args[0], Keys: args[1:]}, &resp); err != nil {
+		fail("keys: %v", err)
+	}
+}
+
+// cmdFlow pauses or resumes reading a session's output:
+// pty-daemon pause|resume <session-id>
+func cmdFlow(verb string, args []string) {
+	if len(args) != 1 {
+		fail("Usage: pty-daemon %s <session-id>", verb)
+	}
+	var resp FlowEvent
+	if err := request(PauseRequest{Type: verb, ID: args[0]}, &resp); err != nil {
+		fail("%s: %v", verb, err)
+	}
+	if resp.Paused {
+		fmt.Printf("%s: paused\n", resp.ID)
+	} else {
+		fmt.Printf("%s: running\n", resp.ID)
+	}
+}
+
+// cmdOutput prints part of a session's scrollback, by offset or time:
+// pty-daemon output [--since T] [--until T] [--from N] [--to N] <session-id>
+func cmdOutput(args []string) {
+	fs := flag.NewFlagSet("output", flag.ExitOnError)
+	since := fs.String("since", "", "start time: RFC 3339, HH:MM[:SS] today, or a duration ago (5m)")
+	until := fs.String("until", "", "end time, in the same forms")
+	from := fs.Uint64("from", 0, "start offset")
+	to := fs.Uint64("to", 0, "end offset")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fail("Usage: pty-daemon output [--since T] [--until T] [--from N] [--to N] <session-id>")
+	}
+	r, err := outputRange(*from, *to, *since, *until)
+	if err != nil {
+		fail("output: %v", err)
+	}
+	var resp OutputResponse
+	if err := request(OutputRequest{Type: "output", ID: fs.Arg(0), OutputRange: r}, &resp); err != nil {
+		fail("output: %v", err)
+	}
+	os.Stdout.WriteString(resp.Data)
+}
+
+// cmdExport renders part of a session's scrollback as text or HTML, to a
+// file or stdout:
+// pty-daemon export [--format text|html] [-o file] [range flags] <session-id>
+func cmdExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "", "text or html (default: from the -o extension, else text)")
+	path := fs.String("o", "", "write to this file rather than stdout")
+	since := fs.String("since", "", "start time: RFC 3339, HH:MM[:SS] today, or a duration ago (5m)")
+	until := fs.String("until", "", "end time, in the same forms")
+	from := fs.Uint64("from", 0, "start offset")
+	to := fs.Uint64("to", 0, "end offset")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fail("Usage: pty-daemon export [--format text|html] [-o file] [--since T] [--until T] [--from N] [--to N] <session-id>")
+	}
+	r, err := outputRange(*from, *to, *since, *until)
+	if err != nil {
+		fail("export: %v", err)
+	}
+	req := ExportRequest{Type: "export", ID: fs.Arg(0), Format: *format, OutputRange: r}
+	if ext := strings.ToLower(filepath.Ext(*path)); req.Format == "" && (ext == ".html" || ext == ".htm") {
+		req.Format = "html"
+	}
+	var resp ExportResponse
+	if err := request(req, &resp); err != nil {
+		fail("export: %v", err)
+	}
+	if *path == "" {
+		os.Stdout.WriteString(resp.Data)
+		return
+	}
+	// Scrollback can hold secrets, so a new file is private to the user.
+	if err := os.WriteFile(*path, []byte(resp.Data), 0600); err != nil {
+		fail("export: %v", err)
+	}
+	fmt.Printf("Wrote %s (%s, %s)\n", *path, resp.Format, formatBytes(int64(resp.Size)))
+}
+
+// outputRange builds a range from command-line flags.
+func outputRange(from, to uint64, since, until string) (OutputRange, error) {
+	r := OutputRange{From: from, To: to}
+	now := time.Now()
+	for _, f := range []struct {
+		arg string
+		dst *int64
+	}{{since, &r.Since}, {until, &r.Until}} {
+		if f.arg == "" {
+			continue
+		}
+		t, err := parseWhen(f.arg, now)
+		if err != nil {
+			return r, err
+		}
+		*f.dst = t.UnixMilli()
+	}
+	return r, nil
+}
+
+// parseWhen reads a time given on the command line: RFC 3339, a clock
+// time today in local time, or a duration before now.
+func parseWhen(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			y, m, d := now.Date()
+			return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), 0, now.Location()), nil
+		}
+	}
+	if d, err := time.ParseDuration(strings.TrimPrefix(s, "-")); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("can't read time %q", s)
+}
+
+// cmdPaste pastes a file, or stdin, into a session:
+// pty-daemon paste [--bracketed=true|false] <session-id> [file]
+func cmdPaste(args []string) {
+	fs := flag.NewFlagSet("paste", flag.ExitOnError)
+	bracketed := fs.String("bracketed", "auto", "auto (follow the application), true or false")
+	fs.Parse(args)
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fail("Usage: pty-daemon paste [--bracketed=auto|true|false] <session-id> [file]")
+	}
+	req := PasteRequest{Type: "paste", ID: fs.Arg(0)}
+	switch *bracketed {
+	case "auto":
+	case "true", "false":
+		b := *bracketed == "true"
+		req.Bracketed = &b
+	default:
+		fail("paste: --bracketed must be auto, true or false")
+	}
+	var data []byte
+	var err error
+	if fs.NArg() == 2 && fs.Arg(1) != "-" {
+		data, err = os.ReadFile(fs.Arg(1))
+	} else {
+		data, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		fail("paste: %v", err)
+	}
+	req.Data = string(data)
+	var resp SentResponse
+	if err := request(req, &resp); err != nil {
+		fail("paste: %v", err)
+	}
+	mode := "plain"
+	if resp.Bracketed {
+		mode = "bracketed"
+	}
+	fmt.Printf("Pasted %d bytes (%s)\n", len(data), mode)
+}
+
+// idList collects repeated or comma-separated session IDs.
+type idList []string
+
+func (l *idList) String() string { return strings.Join(*l, ",") }
+
+func (l *idList) Set(s string) error {
+	for _, id := range strings.Split(s, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			*l = append(*l, id)
+		}
+	}
+	return nil
+}
+
+// cmdWriteMany sends the same input to several sessions:
+// pty-daemon write-many [--ids a,b] [--group g] [-l selector] [--enter] [--all-or-nothing] <text>
+func cmdWriteMany(args []string) {
+	fs := flag.NewFlagSet("write-many", flag.ExitOnError)
+	var ids idList
+	fs.Var(&ids, "ids", "session IDs, comma-separated or repeated")
+	group := fs.String("group", "", "a named session group")
+	selector := fs.String("l", "", "label selector for live sessions")
+	enter := fs.Bool("enter", false, "press Enter after the text")
+	atomic := fs.Bool("all-or-nothing", false, "send only if every session can take it")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fail("Usage: pty-daemon write-many [--ids a,b] [--group g] [-l selector] [--enter] [--all-or-nothing] <text>")
+	}
+	data := fs.Arg(0)
+	if *enter {
+		data += "\r"
+	}
+	var resp WroteManyResponse
+	req := WriteManyRequest{Type: "writeMany", IDs: ids, Group: *group, Selector: *selector, Data: data, AllOrNothing: *atomic}
+	if err := request(req, &resp); err != nil {
+		fail("write-many: %v", err)
+	}
+	failed := false
+	for _, r := range resp.Results {
+		if r.OK {
+			fmt.Printf("%s: ok\n", r.ID)
+		} else {
+			fmt.Printf("%s: %s\n", r.ID, r.Error)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// cmdGroup shows, changes or lists session groups:
+// pty-daemon group [<name> [--set a,b] [--add id] [--remove id]]
+func cmdGroup(args []string) {
+	if len(args) == 0 {
+		var resp GroupsResponse
+		if err := request(GroupsRequest{Type: "groups"}, &resp); err != nil {
+			fail("group: %v", err)
+		}
+		names := make([]string, 0, len(resp.Groups))
+		for name := range resp.Groups {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("%s: %s\n", name, strings.Join(resp.Groups[name], " "))
+		}
+		return
+	}
+	if strings.HasPrefix(args[0], "-") {
+		fail("Usage: pty-daemon group [<name> [--set a,b] [--add id] [--remove id]]")
+	}
+	fs := flag.NewFlagSet("group", flag.ExitOnError)
+	var set, add, remove idList
+	fs.Var(&set, "set", "replace the members")
+	fs.Var(&add, "add", "add members")
+	fs.Var(&remove, "remove", "remove members")
+	fs.Parse(args[1:])
+	req := GroupRequest{Type: "group", Name: args[0], Add: add, Remove: remove}
+	if set != nil {
+		req.Set = set
+	}
+	var resp GroupResponse
+	if err := request(req, &resp); err != nil {
+		fail("group: %v", err)
+	}
+	if len(resp.IDs) == 0 {
+		fmt.Printf("%s: (deleted)\n", resp.Name)
+		return
+	}
+	fmt.Printf("%s: %s\n", resp.Name, strings.Join(resp.IDs, " "))
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+const configName = "pty-daemon.json"
+
+func configPath() string { return filepath.Join(socketDir(), configName) }
+
+// duration is a time.Duration that reads and writes as "90s", "5m" etc.
+type duration time.Duration
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+// Config is the daemon's configuration, read from pty-daemon.json in the
+// spaceterm home. Every field is optional; missing ones keep the defaults.
+// Fields marked "restart" only take effect when the daemon restarts; the
+// rest are applied by a reload (SIGHUP or a "reload" request).
+type Config struct {
+	SocketPath  string `json:"socketPath,omitempty"`  // restart; its directory must already be private
+	MetricsAddr string `json:"metricsAddr,omitempty"` // restart; loopback only
+
+	LogLevel    string `json:"logLevel"`
+	LogMaxBytes int64  `json:"logMaxBytes"`
+	LogKeep     int    `json:"logKeep"`
+
+	RingSize         int      `json:"ringSize"` // new sessions only
+	MaxPendingInput  int      `json:"maxPendingInput"`
+	OutputCoalesce   duration `json:"outputCoalesce"` // gather output this long before sending
+	OutputMaxRate    int      `json:"outputMaxRate"`  // batches per second per session; 0 is no cap
+	FlowHighWater    int      `json:"flowHighWater"`  // unacked bytes that pause a session
+	FlowLowWater     int      `json:"flowLowWater"`   // and that resume it
+	SweepInterval    duration `json:"sweepInterval"`
+	SweepMaxAge      duration `json:"sweepMaxAge"`
+	PortScanInterval duration `json:"portScanInterval"`
+
+	Journal         bool     `json:"journal"` // restart
+	JournalInterval duration `json:"journalInterval"`
+	JournalMaxAge   duration `json:"journalMaxAge"` // 0 keeps entries forever
+
+	// Any allowed uids widen the socket's permissions (see socketModes);
+	// adding the first or removing the last takes a restart.
+	AllowedUids   []uint32       `json:"allowedUids,omitempty"`
+	ResizePolicy  string         `json:"resizePolicy"`            // new sessions only
+	DefaultLimits *SessionLimits `json:"defaultLimits,omitempty"` // new sessions only
+
+	DestroyHupTimeout  duration `json:"destroyHupTimeout"`
+	DestroyTermTimeout duration `json:"destroyTermTimeout"`
+	DestroyKillTimeout duration `json:"destroyKillTimeout"`
+}
+
+// defaultConfig is what the daemon did before it had a config file.
+func defaultConfig() Config {
+	return Config{
+		LogLevel:           "info",
+		LogMaxBytes:        logMaxBytes,
+		LogKeep:            logKeep,
+		RingSize:           DefaultRingSize,
+		MaxPendingInput:    4 * 1024 * 1024,
+		OutputCoalesce:     duration(4 * time.Millisecond),
+		OutputMaxRate:      60,
+		FlowHighWater:      512 * 1024,
+		FlowLowWater:       64 * 1024,
+		SweepInterval:      duration(60 * time.Second),
+		SweepMaxAge:        duration(5 * time.Minute),
+		PortScanInterval:   duration(2 * time.Second),
+		Journal:            true,
+		JournalInterval:    duration(10 * time.Second),
+		JournalMaxAge:      duration(7 * 24 * time.Hour),
+		ResizePolicy:       string(defaultResizePolicy),
+		DestroyHupTimeout:  duration(2 * time.Second),
+		DestroyTermTimeout: duration(3 * time.Second),
+		DestroyKillTimeout: duration(2 * time.Second),
+	}
+}
+
+// loadConfig reads the config file over the defaults, applies environment
+// overrides and validates the result. A missing file is not an error.
+func loadConfig(path string) (Config, error) {
+	cfg := defaultConfig()
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return cfg, err
+	default:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields() // catch typos instead of ignoring them
+		if err := dec.Decode(&cfg); err != nil {
+			return cfg, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if err := cfg.applyEnv(); err != nil {
+		return cfg, err
+	}
+	if err := cfg.validate(); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// applyEnv lets the older SPACETERM_PTY_* variables override the file.
+func (c *Config) applyEnv() error {
+	if s := os.Getenv(allowedUidsEnv); s != "" {
+		uids, err := parseUidList(s)
+		if err != nil {
+			return fmt.Errorf("%s: %w", allowedUidsEnv, err)
+		}
+		c.AllowedUids = append(c.AllowedUids, uids...)
+	}
+	if s := os.Getenv(metricsAddrEnv); s != "" {
+		c.MetricsAddr = s
+	}
+	if s := os.Getenv(logLevelEnv); s != "" {
+		c.LogLevel = s
+	}
+	return nil
+}
+
+func (c Config) validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	check(c.SocketPath == "" || filepath.IsAbs(c.SocketPath), "socketPath must be absolute")
+	if c.MetricsAddr != "" {
+		_, _, err := net.SplitHostPort(c.MetricsAddr)
+		check(err == nil, "metricsAddr: %v", err)
+	}
+	_, err := parseLogLevel(c.LogLevel)
+	check(err == nil, "logLevel: %v", err)
+	check(c.LogMaxBytes >= 64*1024, "logMaxBytes must be at least 64KiB")
+	check(c.LogKeep >= 0, "logKeep must not be negative")
+	check(c.RingSize >= 4*1024 && c.RingSize <= 256*1024*1024, "ringSize must be between 4KiB and 256MiB")
+	check(c.MaxPendingInput >= 64*1024 && c.MaxPendingInput <= 256*1024*1024,
+		"maxPendingInput must be between 64KiB and 256MiB")
+	check(c.OutputCoalesce >= 0 && c.OutputCoalesce <= duration(100*time.Millisecond),
+		"outputCoalesce must be between 0 and 100ms")
+	check(c.OutputMaxRate >= 0 && c.OutputMaxRate <= 1000, "outputMaxRate must be between 0 and 1000")
+	check(c.FlowLowWater > 0 && c.FlowLowWater < c.FlowHighWater,
+		"flowLowWater must be positive and below flowHighWater")
+	check(c.SweepInterval >= duration(time.Second), "sweepInterval must be at least 1s")
+	check(c.SweepMaxAge >= 0, "sweepMaxAge must not be negative")
+	check(c.PortScanInterval >= duration(250*time.Millisecond), "portScanInterval must be at least 250ms")
+	check(c.JournalInterval >= duration(time.Second), "journalInterval must be at least 1s")
+	check(c.JournalMaxAge >= 0, "journalMaxAge must not be negative")
+	_, err = parseResizePolicy(c.ResizePolicy)
+	check(err == nil, "resizePolicy: %v", err)
+	if l := c.DefaultLimits; l != nil {
+		check(l.MemoryBytes >= 0 && l.CPUs >= 0 && l.Pids >= 0, "defaultLimits must not be negative")
+	}
+	check(c.DestroyHupTimeout > 0 && c.DestroyTermTimeout > 0 && c.DestroyKillTimeout > 0,
+		"destroy timeouts must be positive")
+	return errors.Join(errs...)
+}
+
+// restartRequired names the changed fields a reload can't apply.
+func restartRequired(old, next Config) []string {
+	var out []string
+	if old.SocketPath != next.SocketPath {
+		out = append(out, "socketPath")
+	}
+	if old.MetricsAddr != next.MetricsAddr {
+		out = append(out, "metricsAddr")
+	}
+	if old.Journal != next.Journal {
+		out = append(out, "journal")
+	}
+	// The list itself is reloaded, but going from none to some (or back)
+	// changes the socket's permissions, which are set at startup.
+	if (len(old.AllowedUids) > 0) != (len(next.AllowedUids) > 0) {
+		out = append(out, "allowedUids")
+	}
+	return out
+}
+
+// escalation returns the graceful-destroy timeouts.
+func (c Config) escalation() escalation {
+	return escalation{
+		AfterHup:  time.Duration(c.DestroyHupTimeout),
+		AfterTerm: time.Duration(c.DestroyTermTimeout),
+		AfterKill: time.Duration(c.DestroyKillTimeout),
+	}
+}
+
+// config holds the active configuration. It starts as the defaults so
+// code running before main loads the file still sees sane values.
+var config atomic.Pointer[Config]
+
+func init() {
+	cfg := defaultConfig()
+	config.Store(&cfg)
+}
+
+// currentConfig returns the active configuration. Callers must not modify it.
+func currentConfig() *Config { return config.Load() }
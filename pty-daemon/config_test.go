@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), configName)
+	if err := os.WriteFile(path, []byte(body), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig_MissingFileIsDefaults(t *testing.T) {
+	cfg, err := loadConfig(filepath.Join(t.TempDir(), "nope.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RingSize != DefaultRingSize || time.Duration(cfg.SweepMaxAge) != 5*time.Minute {
+		t.Fatalf("expected defaults, got %+v", cfg)
+	}
+}
+
+func TestLoadConfig_OverridesAndDurations(t *testing.T) {
+	path := writeConfig(t, `{"ringSize": 65536, "sweepInterval": "10s", "logLevel": "debug"}`)
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RingSize != 65536 || time.Duration(cfg.SweepInterval) != 10*time.Second || cfg.LogLevel != "debug" {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+	if time.Duration(cfg.SweepMaxAge) != 5*time.Minute {
+		t.Fatal("unset fields should keep their defaults")
+	}
+}
+
+func TestLoadConfig_RejectsTyposAndBadValues(t *testing.T) {
+	if _, err := loadConfig(writeConfig(t, `{"ringSzie": 65536}`)); err == nil {
+		t.Fatal("expected unknown field to be rejected")
+	}
+	_, err := loadConfig(writeConfig(t, `{"ringSize": 10, "resizePolicy": "huge", "sweepInterval": "1ms"}`))
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, want := range []string{"ringSize", "resizePolicy", "sweepInterval"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %s in error: %v", want, err)
+		}
+	}
+}
+
+func TestLoadConfig_EnvOverrides(t *testing.T) {
+	t.Setenv(logLevelEnv, "warn")
+	t.Setenv(allowedUidsEnv, "4242")
+	cfg, err := loadConfig(writeConfig(t, `{"logLevel": "debug", "allowedUids": [7]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.LogLevel != "warn" {
+		t.Fatalf("expected env level to win, got %s", cfg.LogLevel)
+	}
+	if len(cfg.AllowedUids) != 2 {
+		t.Fatalf("expected file and env uids combined, got %v", cfg.AllowedUids)
+	}
+}
+
+func TestRestartRequired(t *testing.T) {
+	a := defaultConfig()
+	b := a
+	b.SocketPath = "/tmp/other.sock"
+	b.RingSize = 2 * DefaultRingSize
+	got := restartRequired(a, b)
+	if len(got) != 1 || got[0] != "socketPath" {
+		t.Fatalf("expected only socketPath, got %v", got)
+	}
+
+	a.AllowedUids = []uint32{1001}
+	b = a
+	b.AllowedUids = []uint32{1001, 1002}
+	if got := restartRequired(a, b); len(got) != 0 {
+		t.Fatalf("changing a non-empty allow-list shouldn't need a restart, got %v", got)
+	}
+	b.AllowedUids = nil
+	if got := restartRequired(a, b); len(got) != 1 || got[0] != "allowedUids" {
+		t.Fatalf("expected allowedUids, got %v", got)
+	}
+}
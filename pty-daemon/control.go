@@ -0,0 +1,184 @@
+package main
+
+import "fmt"
+
+// attachMode says what an attached client may do with a session.
+type attachMode string
+
+const (
+	// modeController may write, and decides the size under the controller
+	// resize policy. At most one per session.
+	modeController attachMode = "controller"
+	// modeViewer only receives output.
+	modeViewer attachMode = "viewer"
+)
+
+// parseAttachMode maps the wire value to a mode. Empty means controller,
+// which is what every client got before modes existed.
+func parseAttachMode(s string) (attachMode, error) {
+	switch attachMode(s) {
+	case "", modeController:
+		return modeController, nil
+	case modeViewer:
+		return modeViewer, nil
+	}
+	return "", fmt.Errorf("unknown attach mode: %s", s)
+}
+
+// controllers maps session ID → the client allowed to send it input.
+// Guarded by clientsMu, like each client's attached map.
+var controllers = make(map[string]*Client)
+
+// attachClient subscribes c to a session and returns the mode it actually
+// got: asking for control of a session someone else controls yields a
+// viewer attachment, and the client must take control explicitly.
+func attachClient(c *Client, sessionID string, want attachMode) attachMode {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	mode := want
+	if want == modeController {
+		if owner, ok := controllers[sessionID]; ok && owner != c {
+			mode = modeViewer
+		} else {
+			controllers[sessionID] = c
+		}
+	} else if controllers[sessionID] == c {
+		delete(controllers, sessionID)
+	}
+	c.attached[sessionID] = mode
+	return mode
+}
+
+// detachClient unsubscribes c, giving up control and its pause if it held
+// them. Reports whether control was released so the caller can notify
+// viewers, and whether nobody holds a pause any more so it can resume.
+func detachClient(c *Client, sessionID string) (releasedControl, releasedPause bool) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	delete(c.attached, sessionID)
+	delete(c.acks, sessionID)
+	if c.pauses[sessionID] {
+		delete(c.pauses, sessionID)
+		releasedPause = !pauseHeldLocked(sessionID)
+	}
+	if controllers[sessionID] == c {
+		delete(controllers, sessionID)
+		releasedControl = true
+	}
+	return releasedControl, releasedPause
+}
+
+// detachAll removes every attachment of a disconnecting client and returns
+// the sessions it controlled and those it was the last to hold paused.
+func detachAll(c *Client) (released, unpaused []string) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	for id := range c.attached {
+		if controllers[id] == c {
+			delete(controllers, id)
+			released = append(released, id)
+		}
+	}
+	c.attached = make(map[string]attachMode)
+	c.acks = make(map[string]uint64)
+	paused := c.pauses
+	c.pauses = make(map[string]bool)
+	for id := range paused {
+		if !pauseHeldLocked(id) {
+			unpaused = append(unpaused, id)
+		}
+	}
+	return released, unpaused
+}
+
+// takeControl makes c the controller of a session it is attached to.
+// Returns the previous controller, or nil if there was none.
+func takeControl(c *Client, sessionID string) (*Client, error) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	if _, ok := c.attached[sessionID]; !ok {
+		return nil, fmt.Errorf("not attached: %s", sessionID)
+	}
+	prev := controllers[sessionID]
+	if prev == c {
+		return nil, nil
+	}
+	if prev != nil {
+		prev.attached[sessionID] = modeViewer
+	}
+	controllers[sessionID] = c
+	c.attached[sessionID] = modeController
+	return prev, nil
+}
+
+// viewersOf returns the IDs of the clients attached to a session as
+// viewers.
+func viewersOf(sessionID string) map[string]bool {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	viewers := make(map[string]bool)
+	for c := range clients {
+		if c.attached[sessionID] == modeViewer {
+			viewers[c.id] = true
+		}
+	}
+	return viewers
+}
+
+// checkInput reports whether c may write to a session. Only a client
+// attached to it as a viewer may not: control arbitrates between attached
+// clients, while one-off writers that aren't attached (the CLI, scripts)
+// may always send input.
+func checkInput(c *Client, sessionID string) error {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	if c.attached[sessionID] == modeViewer {
+		return fmt.Errorf("read-only attachment: %s", sessionID)
+	}
+	return nil
+}
+
+// forgetSession drops control state for a destroyed session.
+func forgetSession(sessionID string) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	delete(controllers, sessionID)
+	for c := range clients {
+		delete(c.attached, sessionID)
+		delete(c.pauses, sessionID)
+	}
+}
+
+// controllerOf returns the controlling client's ID, or "" if none.
+func controllerOf(sessionID string) string {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	if c, ok := controllers[sessionID]; ok {
+		return c.id
+	}
+	return ""
+}
+
+// notifyControl tells every attached client who now controls a session,
+// and what its own mode is as a result.
+func notifyControl(sessionID string, previous string) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	controller := ""
+	if c, ok := controllers[sessionID]; ok {
+		controller = c.id
+	}
+	for c := range clients {
+		mode, ok := c.attached[sessionID]
+		if !ok {
+			continue
+		}
+		c.Send(ControlEvent{
+			Type:       "control",
+			ID:         sessionID,
+			Controller: controller,
+			Previous:   previous,
+			Mode:       string(mode),
+		})
+	}
+}
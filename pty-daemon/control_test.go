@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"testing"
+)
+
+func newTestClient(id string) *Client {
+	c := &Client{id: id, attached: make(map[string]attachMode), pauses: make(map[string]bool), encoder: json.NewEncoder(io.Discard)}
+	clientsMu.Lock()
+	clients[c] = true
+	clientsMu.Unlock()
+	return c
+}
+
+func dropTestClient(c *Client) {
+	detachAll(c)
+	clientsMu.Lock()
+	delete(clients, c)
+	clientsMu.Unlock()
+}
+
+func TestAttach_SecondControllerBecomesViewer(t *testing.T) {
+	a, b := newTestClient("a"), newTestClient("b")
+	defer dropTestClient(a)
+	defer dropTestClient(b)
+
+	if m := attachClient(a, "s1", modeController); m != modeController {
+		t.Fatalf("first attach: expected controller, got %s", m)
+	}
+	if m := attachClient(b, "s1", modeController); m != modeViewer {
+		t.Fatalf("second attach: expected viewer, got %s", m)
+	}
+	if err := checkInput(a, "s1"); err != nil {
+		t.Fatalf("controller input rejected: %v", err)
+	}
+	if err := checkInput(b, "s1"); err == nil {
+		t.Fatal("viewer input should be rejected")
+	}
+}
+
+func TestTakeControl_DemotesPrevious(t *testing.T) {
+	a, b := newTestClient("a"), newTestClient("b")
+	defer dropTestClient(a)
+	defer dropTestClient(b)
+
+	attachClient(a, "s2", modeController)
+	attachClient(b, "s2", modeViewer)
+	prev, err := takeControl(b, "s2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prev != a {
+		t.Fatalf("expected previous controller a, got %v", prev)
+	}
+	if controllerOf("s2") != "b" {
+		t.Fatalf("expected controller b, got %q", controllerOf("s2"))
+	}
+	if err := checkInput(a, "s2"); err == nil {
+		t.Fatal("demoted client should not be able to write")
+	}
+}
+
+func TestCheckInput_UncontrolledSession(t *testing.T) {
+	a, b := newTestClient("a"), newTestClient("b")
+	defer dropTestClient(a)
+	defer dropTestClient(b)
+
+	attachClient(a, "s3", modeController)
+	attachClient(b, "s3", modeViewer)
+	if released, _ := detachClient(a, "s3"); !released {
+		t.Fatal("detaching the controller should release control")
+	}
+	if err := checkInput(b, "s3"); err == nil {
+		t.Fatal("viewer should stay read-only after controller leaves")
+	}
+	c := newTestClient("c")
+	defer dropTestClient(c)
+	if err := checkInput(c, "s3"); err != nil {
+		t.Fatalf("unattached writer to uncontrolled session rejected: %v", err)
+	}
+}
+
+func TestCheckInput_UnattachedWriterToControlledSession(t *testing.T) {
+	a, b := newTestClient("a"), newTestClient("b")
+	defer dropTestClient(a)
+	defer dropTestClient(b)
+
+	attachClient(a, "s5", modeController)
+	if err := checkInput(b, "s5"); err != nil {
+		t.Fatalf("unattached writer rejected while a controller is attached: %v", err)
+	}
+	attachClient(b, "s5", modeController) // becomes a viewer
+	if err := checkInput(b, "s5"); err == nil {
+		t.Fatal("viewer input should be rejected")
+	}
+}
+
+func TestTakeControl_RequiresAttach(t *testing.T) {
+	a := newTestClient("a")
+	defer dropTestClient(a)
+	if _, err := takeControl(a, "s4"); err == nil {
+		t.Fatal("expected error taking control without attaching")
+	}
+}
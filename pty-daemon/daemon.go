@@ -4,21 +4,28 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
 // Client represents a single connection to the daemon.
 type Client struct {
+	id       string
 	conn     net.Conn
 	mu       sync.Mutex
-	attached map[string]bool // session IDs this client receives output for
+	attached map[string]attachMode // session IDs this client receives output for
+	acks     map[string]uint64     // session ID → output offset acknowledged, if it acks
+	pauses   map[string]bool       // sessions this client paused by request
+	replay   replayOptions         // set by hello; only the client's own goroutine uses it
 	encoder  *json.Encoder
+	sent     atomic.Uint64 // messages sent, for stats
 }
 
 // Send writes a JSON message to the client. Thread-safe.
@@ -26,94 +33,322 @@ func (c *Client) Send(msg interface{}) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.encoder.Encode(msg) //nolint: encoder writes to socket, errors handled by disconnect
+	c.sent.Add(1)
+}
+
+// sendLine writes a message that has already been encoded, newline and
+// all. Thread-safe.
+func (c *Client) sendLine(line []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.Write(line) //nolint: errors handled by disconnect, as in Send
+	c.sent.Add(1)
 }
 
 var (
-	clientsMu sync.Mutex
-	clients   = make(map[*Client]bool)
+	clientsMu    sync.Mutex
+	clients      = make(map[*Client]bool)
+	nextClientID atomic.Uint64
+
+	// shuttingDown is set once a stop signal has been received.
+	shuttingDown atomic.Bool
 )
 
 // broadcastToAttached sends a message to all clients attached to a session.
+// It is encoded once, however many clients there are.
 func broadcastToAttached(sessionID string, msg interface{}) {
+	line, err := json.Marshal(msg)
+	if err != nil {
+		slog.Error("broadcast.encode_failed", "session", sessionID, "err", err)
+		return
+	}
+	line = append(line, '\n')
 	clientsMu.Lock()
 	defer clientsMu.Unlock()
 	for c := range clients {
-		if c.attached[sessionID] {
-			c.Send(msg)
+		if _, ok := c.attached[sessionID]; ok {
+			c.sendLine(line)
 		}
 	}
 }
 
+// announceSize tells attached clients a session's new effective size.
+func announceSize(sessionID string, size ptySize, changed bool) {
+	if !changed {
+		return
+	}
+	broadcastToAttached(sessionID, ResizedEvent{
+		Type: "resized",
+		ID:   sessionID,
+		Cols: size.Cols,
+		Rows: size.Rows,
+	})
+}
+
+// rearbitrate reapplies a session's resize policy after its clients or
+// controller changed, announcing the result.
+func rearbitrate(sm *SessionManager, sessionID string) {
+	if size, changed, err := sm.Rearbitrate(sessionID, controllerOf(sessionID), viewersOf(sessionID)); err == nil {
+		announceSize(sessionID, size, changed)
+	}
+}
+
+// peers is the active peer policy, swapped on reload.
+var peers atomic.Pointer[PeerPolicy]
+
+// reloadConfig re-reads the config file and applies what is safe to change
+// at runtime. An invalid file leaves the running config untouched. Returns
+// the changed settings that need a restart.
+func reloadConfig() ([]string, error) {
+	old := currentConfig()
+	next, err := loadConfig(configPath())
+	if err != nil {
+		slog.Error("config.reload_failed", "err", err)
+		return nil, err
+	}
+	restart := restartRequired(*old, next)
+	// Keep restart-only settings as they are, so e.g. socketPath() still
+	// names the socket we're actually listening on.
+	next.SocketPath = old.SocketPath
+	next.MetricsAddr = old.MetricsAddr
+	next.Journal = old.Journal
+
+	level, _ := parseLogLevel(next.LogLevel) // validated by loadConfig
+	logLevel.Set(level)
+	if logWriter != nil {
+		logWriter.SetLimits(next.LogMaxBytes, next.LogKeep)
+	}
+	peers.Store(NewPeerPolicy(next.AllowedUids))
+	config.Store(&next)
+	slog.Info("config.reloaded", "restartRequired", restart)
+	return restart, nil
+}
+
 // runDaemon is the main daemon loop. Called by `pty-daemon run`.
 func runDaemon() {
-	// Set up logging.
-	logFile, err := os.OpenFile(logPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	// The socket lives in a directory only we can enter, or with
+	// allowedUids only search, so nobody can list or replace what's in it.
+	// The spaceterm home is ours to create and tighten; a configured
+	// socket path's directory (perhaps $HOME or /tmp) only gets checked.
+	shared := len(currentConfig().AllowedUids) > 0
+	if err := ensureSocketDir(socketDir(), shared); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to prepare %s: %v\n", socketDir(), err)
+		os.Exit(1)
+	}
+	if dir := filepath.Dir(socketPath()); dir != filepath.Clean(socketDir()) {
+		if err := checkSocketDir(dir, shared); err != nil {
+			fmt.Fprintf(os.Stderr, "Refusing socket directory %s: %v\n", dir, err)
+			os.Exit(1)
+		}
+	}
+
+	// Take the single-instance lock before touching anything shared. It is
+	// held until the process exits; the kernel releases it even on SIGKILL.
+	lock, err := acquireLock()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to open log file: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Daemon already running: %v\n", err)
 		os.Exit(1)
 	}
-	log.SetOutput(logFile)
-	log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds)
+	defer lock.Close()
 
-	// Write PID file.
-	os.MkdirAll(socketDir(), 0755)
-	os.WriteFile(pidPath(), []byte(fmt.Sprintf("%d", os.Getpid())), 0644)
-	log.Printf("Daemon starting (pid %d)", os.Getpid())
+	// Set up logging.
+	cfg := currentConfig()
+	if err := setupLogging(logPath(), cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to set up logging: %v\n", err)
+		os.Exit(1)
+	}
+	peers.Store(NewPeerPolicy(cfg.AllowedUids))
+
+	slog.Info("daemon.starting", "pid", os.Getpid(), "version", version)
+
+	// Under socket activation systemd owns the socket; it is already
+	// listening, so the liveness probe below would only find systemd.
+	activated, err := systemdListener()
+	if err != nil {
+		fatal("daemon.activation_failed", "err", err)
+	}
+
+	// A socket file may be left over from a crash, but something could also
+	// still be serving it (e.g. a daemon from before the lock existed, or
+	// one under another home sharing socketPath). Only remove it if nothing
+	// answers.
+	if _, err := os.Lstat(socketPath()); err == nil && activated == nil {
+		if conn, err := net.DialTimeout("unix", socketPath(), time.Second); err == nil {
+			conn.Close()
+			fatal("daemon.socket_in_use", "path", socketPath())
+		}
+		slog.Info("daemon.stale_socket", "path", socketPath())
+		os.Remove(socketPath())
+	}
 
-	// Remove stale socket.
-	os.Remove(socketPath())
+	// Write PID file. The lock file is authoritative; this is kept for
+	// tooling that reads it, and for stopping daemons that predate the
+	// lock, so it is only written once the socket is known to be ours.
+	os.WriteFile(pidPath(), []byte(fmt.Sprintf("%d", os.Getpid())), 0644)
 
 	// Initialize session manager with broadcast callbacks.
-	sm := NewSessionManager(
-		func(sessionID string, data string) {
+	var sm *SessionManager
+	sm = NewSessionManager(
+		func(sessionID string, data string, offset uint64) {
+			start := time.Now()
+			metrics.outputBatches.Add(1)
 			broadcastToAttached(sessionID, DataEvent{
-				Type: "data",
-				ID:   sessionID,
-				Data: data,
+				Type:   "data",
+				ID:     sessionID,
+				Data:   data,
+				Offset: offset,
 			})
+			metrics.broadcast.Observe(time.Since(start))
+			updateFlow(sm, sessionID)
 		},
-		func(sessionID string, exitCode int, pid int) {
-			log.Printf("Session exited: %s (pid %d, code %d)", sessionID, pid, exitCode)
+		func(sessionID string, exitCode int, pid int, detail ExitDetail) {
+			metrics.sessionsExited.Add(1)
+			slog.Info("session.exited", "session", sessionID, "pid", pid, "code", exitCode,
+				"signal", detail.Signal, "core", detail.CoreDumped, "runtimeMs", detail.RuntimeMs)
 			broadcastToAttached(sessionID, ExitEvent{
-				Type:     "exit",
-				ID:       sessionID,
-				ExitCode: exitCode,
-				Pid:      pid,
+				Type:       "exit",
+				ID:         sessionID,
+				ExitCode:   exitCode,
+				Pid:        pid,
+				ExitDetail: detail,
 			})
 		},
 	)
 
-	// Dead session sweeper: every 60s, remove sessions dead for >5 minutes.
+	sm.onDrained = func(sessionID string, dropped int) {
+		broadcastToAttached(sessionID, DrainedEvent{Type: "drained", ID: sessionID, Dropped: dropped})
+	}
+
+	if cg, err := setupCgroups(); err != nil {
+		slog.Info("cgroups.unavailable", "err", err)
+	} else {
+		sm.UseCgroups(cg)
+		slog.Info("cgroups.enabled", "base", cg.base)
+	}
+
+	if cfg.Journal {
+		if j, err := openJournal(journalDir()); err != nil {
+			slog.Warn("journal.unavailable", "err", err)
+		} else {
+			sm.UseJournal(j)
+			slog.Info("journal.enabled", "dir", j.dir, "archived", len(sm.Archived()))
+		}
+	}
+
+	if err := groups.load(groupsPath()); err != nil {
+		slog.Warn("groups.load_failed", "path", groupsPath(), "err", err)
+	}
+
+	// Dead session sweeper: every sweepInterval (60s), remove sessions dead
+	// for longer than sweepMaxAge (5 minutes), and journal entries older
+	// than journalMaxAge. All are re-read each round so a reload takes
+	// effect without restarting the loop.
 	go func() {
-		ticker := time.NewTicker(60 * time.Second)
-		defer ticker.Stop()
-		for range ticker.C {
-			if n := sm.SweepDead(5 * time.Minute); n > 0 {
-				log.Printf("Swept %d dead session(s)", n)
+		for {
+			time.Sleep(time.Duration(currentConfig().SweepInterval))
+			swept := sm.SweepDead(time.Duration(currentConfig().SweepMaxAge))
+			// A later session may reuse an ID; it mustn't inherit the
+			// old one's controller.
+			for _, id := range swept {
+				forgetSession(id)
+			}
+			metrics.sweeps.Add(1)
+			metrics.swept.Add(uint64(len(swept)))
+			metrics.lastSweep.Store(time.Now().UnixMilli())
+			if len(swept) > 0 {
+				slog.Info("sweeper.swept", "count", len(swept))
+			}
+			if n := sm.PruneJournal(time.Duration(currentConfig().JournalMaxAge)); n > 0 {
+				slog.Info("journal.pruned", "count", n)
 			}
 		}
 	}()
 
-	// Listen on Unix domain socket.
-	ln, err := net.Listen("unix", socketPath())
-	if err != nil {
-		log.Fatalf("Failed to listen on %s: %v", socketPath(), err)
+	// Journal checkpoints: every journalInterval (10s), save each session's
+	// cwd and last sign of life; scrollback waits for exit or shutdown.
+	go func() {
+		for {
+			time.Sleep(time.Duration(currentConfig().JournalInterval))
+			sm.Checkpoint()
+		}
+	}()
+
+	// Port watcher: every portScanInterval (2s), report sessions that start
+	// or stop listening.
+	go func() {
+		for {
+			time.Sleep(time.Duration(currentConfig().PortScanInterval))
+			events, err := sm.ScanPorts()
+			if err != nil {
+				slog.Warn("ports.scan_failed", "err", err)
+			}
+			for _, ev := range events {
+				slog.Info("session.port", "session", ev.ID, "listening", ev.Listening,
+					"addr", ev.Addr, "port", ev.Port, "pid", ev.Pid)
+				broadcastToAttached(ev.ID, ev)
+			}
+		}
+	}()
+
+	// Listen on Unix domain socket, owner-only unless other uids may
+	// connect.
+	ln := activated
+	if ln == nil {
+		ln, err = listenSocket(socketPath(), shared)
+		if err != nil {
+			removePidFile()
+			fatal("daemon.listen_failed", "path", socketPath(), "err", err)
+		}
+	} else {
+		// Don't unlink systemd's socket when we close it.
+		ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	}
+	slog.Info("daemon.listening", "path", socketPath(), "activated", activated != nil)
+
+	if addr := cfg.MetricsAddr; addr != "" {
+		if err := serveMetrics(addr, sm); err != nil {
+			slog.Warn("metrics.disabled", "addr", addr, "err", err)
+		} else {
+			slog.Info("metrics.serving", "url", "http://"+addr+"/metrics")
+		}
+	}
+
+	// SIGHUP reloads the config.
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	go func() {
+		for range hupCh {
+			sdNotify("RELOADING=1")
+			reloadConfig()
+			sdNotify("READY=1")
+		}
+	}()
+
+	// Tell systemd we're ready (a no-op otherwise), and keep its watchdog
+	// fed while the session manager stays responsive.
+	if err := sdNotify(fmt.Sprintf("READY=1\nMAINPID=%d", os.Getpid())); err != nil {
+		slog.Warn("systemd.notify_failed", "err", err)
+	}
+	if interval := watchdogInterval(); interval > 0 {
+		slog.Info("systemd.watchdog", "intervalMs", interval.Milliseconds())
+		go runWatchdog(interval, func() { sm.List() })
 	}
-	// Make socket accessible only to owner.
-	os.Chmod(socketPath(), 0600)
-	log.Printf("Listening on %s", socketPath())
 
 	// Graceful shutdown.
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
 	go func() {
 		sig := <-sigCh
-		log.Printf("Received %s, shutting down", sig)
+		slog.Info("daemon.stopping", "signal", sig.String())
+		shuttingDown.Store(true)
+		sdNotify("STOPPING=1")
 		ln.Close()
 		sm.DestroyAll()
-		os.Remove(socketPath())
-		os.Remove(pidPath())
-		log.Printf("Daemon stopped")
+		if activated == nil {
+			os.Remove(socketPath())
+		}
+		removePidFile()
+		slog.Info("daemon.stopped")
 		os.Exit(0)
 	}()
 
@@ -121,7 +356,24 @@ func runDaemon() {
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
-			break // Listener closed (shutdown).
+			if shuttingDown.Load() {
+				// The shutdown goroutine closed the listener and exits
+				// once cleanup is done; returning now would cut it short.
+				select {}
+			}
+			removePidFile()
+			fatal("daemon.accept_failed", "err", err)
+		}
+		cred, err := readPeerCred(conn)
+		if err != nil {
+			slog.Warn("peer.rejected", "err", err)
+			conn.Close()
+			continue
+		}
+		if !peers.Load().Allows(cred) {
+			slog.Warn("peer.rejected", "uid", cred.Uid, "gid", cred.Gid, "pid", cred.Pid)
+			conn.Close()
+			continue
 		}
 		go handleClient(conn, sm)
 	}
@@ -129,20 +381,40 @@ func runDaemon() {
 
 func handleClient(conn net.Conn, sm *SessionManager) {
 	client := &Client{
+		id:       fmt.Sprintf("c%d", nextClientID.Add(1)),
 		conn:     conn,
-		attached: make(map[string]bool),
+		attached: make(map[string]attachMode),
+		acks:     make(map[string]uint64),
+		pauses:   make(map[string]bool),
 		encoder:  json.NewEncoder(conn),
 	}
 
 	clientsMu.Lock()
 	clients[client] = true
 	clientsMu.Unlock()
+	slog.Debug("client.connected", "client", client.id)
 
 	defer func() {
+		released, unpaused := detachAll(client)
 		clientsMu.Lock()
 		delete(clients, client)
 		clientsMu.Unlock()
+		for _, id := range released {
+			notifyControl(id, client.id)
+		}
+		for _, id := range unpaused {
+			releasePause(sm, id)
+		}
+		for _, info := range sm.List() {
+			if size, changed, err := sm.DropClientSize(info.ID, client.id, controllerOf(info.ID)); err == nil {
+				announceSize(info.ID, size, changed)
+			}
+			if info.Paused {
+				updateFlow(sm, info.ID)
+			}
+		}
 		conn.Close()
+		slog.Debug("client.disconnected", "client", client.id)
 	}()
 
 	scanner := bufio.NewScanner(conn)
@@ -176,10 +448,13 @@ func handleClient(conn net.Conn, sm *SessionManager) {
 				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: req.ID})
 				continue
 			}
-			log.Printf("Session created: %s (pid %d, %dx%d, cmd=%s)", req.ID, sess.Pid, req.Cols, req.Rows, req.Command)
-			// Auto-attach the creator.
-			client.attached[req.ID] = true
-			client.Send(CreatedResponse{Type: "created", ID: req.ID, Pid: sess.Pid})
+			metrics.sessionsCreated.Add(1)
+			slog.Info("session.created", "session", req.ID, "client", client.id, "pid", sess.Pid,
+				"cols", req.Cols, "rows", req.Rows, "cmd", req.Command)
+			// Auto-attach the creator as controller.
+			attachClient(client, req.ID, modeController)
+			sm.Resize(req.ID, client.id, req.Cols, req.Rows, false, client.id)
+			client.Send(CreatedResponse{Type: "created", ID: req.ID, Pid: sess.Pid, Enforcement: sess.enforcement})
 
 		case "write":
 			var req WriteRequest
@@ -187,9 +462,135 @@ func handleClient(conn net.Conn, sm *SessionManager) {
 				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: ""})
 				continue
 			}
+			if err := checkInput(client, req.ID); err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: req.ID})
+				continue
+			}
 			if err := sm.Write(req.ID, req.Data); err != nil {
 				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: req.ID})
+				continue
+			}
+			if size, changed, err := sm.NoteActivity(req.ID, client.id, controllerOf(req.ID)); err == nil {
+				announceSize(req.ID, size, changed)
+			}
+
+		case "writeMany":
+			var req WriteManyRequest
+			if err := json.Unmarshal(line, &req); err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: ""})
+				continue
+			}
+			ids, err := writeTargets(req, sm)
+			if err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error()})
+				continue
+			}
+			results := sm.WriteMany(ids, req.Data, req.AllOrNothing, func(id string) error {
+				return checkInput(client, id)
+			})
+			for _, r := range results {
+				if !r.OK {
+					continue
+				}
+				if size, changed, err := sm.NoteActivity(r.ID, client.id, controllerOf(r.ID)); err == nil {
+					announceSize(r.ID, size, changed)
+				}
+			}
+			client.Send(WroteManyResponse{Type: "wroteMany", Results: results})
+
+		case "group":
+			var req GroupRequest
+			if err := json.Unmarshal(line, &req); err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: ""})
+				continue
+			}
+			ids, err := groups.update(req)
+			if err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error()})
+				continue
+			}
+			slog.Info("group.updated", "group", req.Name, "client", client.id, "members", len(ids))
+			client.Send(GroupResponse{Type: "group", Name: req.Name, IDs: ids})
+
+		case "groups":
+			client.Send(GroupsResponse{Type: "groups", Groups: groups.all()})
+
+		case "keys":
+			var req KeysRequest
+			if err := json.Unmarshal(line, &req); err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: ""})
+				continue
+			}
+			if err := checkInput(client, req.ID); err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: req.ID})
+				continue
+			}
+			n, err := sm.Keys(req.ID, req.Keys)
+			if err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: req.ID})
+				continue
+			}
+			if size, changed, err := sm.NoteActivity(req.ID, client.id, controllerOf(req.ID)); err == nil {
+				announceSize(req.ID, size, changed)
+			}
+			client.Send(SentResponse{Type: "sent", ID: req.ID, Bytes: n})
+
+		case "paste":
+			var req PasteRequest
+			if err := json.Unmarshal(line, &req); err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: ""})
+				continue
+			}
+			if err := checkInput(client, req.ID); err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: req.ID})
+				continue
+			}
+			bracketed, n, err := sm.Paste(req.ID, req.Data, req.Bracketed)
+			if err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: req.ID})
+				continue
 			}
+			if size, changed, err := sm.NoteActivity(req.ID, client.id, controllerOf(req.ID)); err == nil {
+				announceSize(req.ID, size, changed)
+			}
+			client.Send(SentResponse{Type: "sent", ID: req.ID, Bytes: n, Bracketed: bracketed})
+
+		case "pause", "resume":
+			var req PauseRequest
+			if err := json.Unmarshal(line, &req); err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: ""})
+				continue
+			}
+			if err := checkInput(client, req.ID); err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: req.ID})
+				continue
+			}
+			changed, paused, err := sm.Pause(req.ID, false, req.Type == "pause")
+			if err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: req.ID})
+				continue
+			}
+			holdPause(client, req.ID, req.Type == "pause")
+			slog.Info("session."+req.Type+"d", "session", req.ID, "client", client.id, "paused", paused)
+			// As with update, the requester always gets exactly one reply.
+			clientsMu.Lock()
+			_, attached := client.attached[req.ID]
+			clientsMu.Unlock()
+			if changed {
+				announceFlow(req.ID, paused)
+			}
+			if !changed || !attached {
+				client.Send(FlowEvent{Type: "flow", ID: req.ID, Paused: paused})
+			}
+
+		case "ack":
+			var req AckRequest
+			if err := json.Unmarshal(line, &req); err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: ""})
+				continue
+			}
+			setAcked(client, req.ID, req.Offset)
+			updateFlow(sm, req.ID)
 
 		case "resize":
 			var req ResizeRequest
@@ -197,8 +598,19 @@ func handleClient(conn net.Conn, sm *SessionManager) {
 				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: ""})
 				continue
 			}
-			if err := sm.Resize(req.ID, req.Cols, req.Rows); err != nil {
+			// Every client's size is recorded, viewers included; the
+			// session's resize policy decides which one the PTY actually
+			// gets, and the controller policy ignores viewers.
+			viewer := viewersOf(req.ID)[client.id]
+			size, changed, err := sm.Resize(req.ID, client.id, req.Cols, req.Rows, viewer, controllerOf(req.ID))
+			if err != nil {
 				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: req.ID})
+				continue
+			}
+			if changed {
+				announceSize(req.ID, size, changed)
+			} else {
+				client.Send(ResizedEvent{Type: "resized", ID: req.ID, Cols: size.Cols, Rows: size.Rows})
 			}
 
 		case "destroy":
@@ -207,26 +619,313 @@ func handleClient(conn net.Conn, sm *SessionManager) {
 				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: ""})
 				continue
 			}
-			log.Printf("Session destroyed: %s", req.ID)
+			if req.Graceful {
+				esc := currentConfig().escalation()
+				if req.HupTimeoutMs > 0 {
+					esc.AfterHup = time.Duration(req.HupTimeoutMs) * time.Millisecond
+				}
+				if req.TermTimeoutMs > 0 {
+					esc.AfterTerm = time.Duration(req.TermTimeoutMs) * time.Millisecond
+				}
+				if req.KillTimeoutMs > 0 {
+					esc.AfterKill = time.Duration(req.KillTimeoutMs) * time.Millisecond
+				}
+				// Escalation can take seconds; don't hold up this client's
+				// other requests while it runs.
+				go func(id string) {
+					step, err := sm.DestroyGraceful(id, esc)
+					forgetSession(id)
+					if err != nil && step == "" {
+						client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: id})
+						return
+					}
+					if err != nil {
+						slog.Warn("session.destroy_incomplete", "session", id, "client", client.id, "err", err)
+					}
+					slog.Info("session.destroyed", "session", id, "client", client.id, "step", step)
+					client.Send(DestroyedResponse{Type: "destroyed", ID: id, Step: step})
+				}(req.ID)
+				continue
+			}
+			slog.Info("session.destroyed", "session", req.ID, "client", client.id)
 			sm.Destroy(req.ID)
+			forgetSession(req.ID)
+
+		case "signal":
+			var req SignalRequest
+			if err := json.Unmarshal(line, &req); err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: ""})
+				continue
+			}
+			if err := checkInput(client, req.ID); err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: req.ID})
+				continue
+			}
+			sig, err := parseSignal(req.Signal)
+			if err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: req.ID})
+				continue
+			}
+			target, err := parseSignalTarget(req.Target)
+			if err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: req.ID})
+				continue
+			}
+			pids, err := sm.Signal(req.ID, sig, target, req.Pid)
+			if err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: req.ID})
+				continue
+			}
+			slog.Info("session.signaled", "session", req.ID, "client", client.id,
+				"signal", signalName(sig), "target", string(target), "pids", pids)
+			client.Send(SignaledResponse{
+				Type:   "signaled",
+				ID:     req.ID,
+				Signal: signalName(sig),
+				Target: string(target),
+				Pids:   pids,
+			})
 
 		case "list":
-			sessions := sm.List()
+			var req ListRequest
+			if err := json.Unmarshal(line, &req); err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: ""})
+				continue
+			}
+			sel, err := parseSelector(req.Selector)
+			if err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error()})
+				continue
+			}
+			sessions := make([]SessionInfo, 0)
+			for _, info := range sm.List() {
+				if sel.matches(info.Labels) {
+					info.Controller = controllerOf(info.ID)
+					sessions = append(sessions, info)
+				}
+			}
 			client.Send(ListResponse{Type: "listed", Sessions: sessions})
 
+		case "update":
+			var req UpdateRequest
+			if err := json.Unmarshal(line, &req); err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: ""})
+				continue
+			}
+			ev, err := sm.Update(req)
+			if err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: req.ID})
+				continue
+			}
+			slog.Info("session.updated", "session", req.ID, "client", client.id, "name", ev.Name)
+			// Attached clients hear about it; the requester gets it as
+			// the reply, once, whether or not it is attached.
+			clientsMu.Lock()
+			_, attached := client.attached[req.ID]
+			clientsMu.Unlock()
+			broadcastToAttached(req.ID, ev)
+			if !attached {
+				client.Send(ev)
+			}
+
+		case "stats":
+			var req StatsRequest
+			if err := json.Unmarshal(line, &req); err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: ""})
+				continue
+			}
+			stats, err := sm.Stats(req.ID)
+			if err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: req.ID})
+				continue
+			}
+			resp := StatsResponse{Type: "stats", Sessions: stats}
+			if req.ID == "" {
+				resp.Daemon = daemonStats(sm)
+			}
+			client.Send(resp)
+
+		case "ps":
+			var req PsRequest
+			if err := json.Unmarshal(line, &req); err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: ""})
+				continue
+			}
+			fg, procs, err := sm.Processes(req.ID)
+			if err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: req.ID})
+				continue
+			}
+			client.Send(PsResponse{Type: "ps", ID: req.ID, ForegroundPgid: fg, Processes: procs})
+
+		case "output":
+			var req OutputRequest
+			if err := json.Unmarshal(line, &req); err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: ""})
+				continue
+			}
+			resp, err := sm.Output(req.ID, req.OutputRange)
+			if err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: req.ID})
+				continue
+			}
+			client.Send(resp)
+
+		case "export":
+			var req ExportRequest
+			if err := json.Unmarshal(line, &req); err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: ""})
+				continue
+			}
+			resp, err := exportOutput(sm, req)
+			if err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: req.ID})
+				continue
+			}
+			slog.Debug("session.exported", "session", req.ID, "client", client.id,
+				"format", resp.Format, "size", resp.Size)
+			client.Send(resp)
+
+		case "times":
+			var req TimesRequest
+			if err := json.Unmarshal(line, &req); err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: ""})
+				continue
+			}
+			times, index, err := sm.Times(req.ID, req.Offsets)
+			if err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: req.ID})
+				continue
+			}
+			client.Send(TimesResponse{Type: "times", ID: req.ID, Times: times, Index: index})
+
+		case "archived":
+			var req ArchivedRequest
+			if err := json.Unmarshal(line, &req); err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: ""})
+				continue
+			}
+			sel, err := parseSelector(req.Selector)
+			if err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error()})
+				continue
+			}
+			archived := make([]ArchivedSession, 0)
+			for _, a := range sm.Archived() {
+				if sel.matches(a.Labels) {
+					archived = append(archived, a)
+				}
+			}
+			client.Send(ArchivedResponse{Type: "archived", Sessions: archived})
+
+		case "resurrect":
+			var req ResurrectRequest
+			if err := json.Unmarshal(line, &req); err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: ""})
+				continue
+			}
+			sess, err := sm.Resurrect(req.ID, req.Cols, req.Rows)
+			if err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: req.ID})
+				continue
+			}
+			metrics.sessionsCreated.Add(1)
+			// Not Cmd.Path, which is sh when rlimits are set through it.
+			sess.mu.Lock()
+			command := sess.entry.Request.Command
+			sess.mu.Unlock()
+			slog.Info("session.resurrected", "session", req.ID, "client", client.id, "pid", sess.Pid,
+				"cwd", sess.Cmd.Dir, "cmd", command)
+			client.Send(ResurrectedResponse{Type: "resurrected", ID: req.ID, Pid: sess.Pid, Cwd: sess.Cmd.Dir})
+
+		case "version":
+			client.Send(VersionResponse{
+				Type:      "version",
+				Version:   version,
+				Pid:       os.Getpid(),
+				StartedAt: metrics.started.UnixMilli(),
+				Sessions:  len(sm.List()),
+			})
+
+		case "reload":
+			restart, err := reloadConfig()
+			if err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error()})
+				continue
+			}
+			client.Send(ReloadedResponse{Type: "reloaded", RestartRequired: restart})
+
+		case "hello":
+			var req HelloRequest
+			if err := json.Unmarshal(line, &req); err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: ""})
+				continue
+			}
+			opts, err := negotiateReplay(req)
+			if err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: ""})
+				continue
+			}
+			client.replay = opts
+			compression := opts.compression
+			if compression == "" {
+				compression = "none"
+			}
+			client.Send(HelloResponse{
+				Type:        "hello",
+				Client:      client.id,
+				Version:     version,
+				Compression: compression,
+				ChunkSize:   opts.chunkSize,
+			})
+
 		case "attach":
 			var req AttachRequest
 			if err := json.Unmarshal(line, &req); err != nil {
 				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: ""})
 				continue
 			}
-			client.attached[req.ID] = true
-			scrollback, err := sm.GetScrollback(req.ID)
+			want, err := parseAttachMode(req.Mode)
 			if err != nil {
 				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: req.ID})
 				continue
 			}
-			client.Send(AttachedResponse{Type: "attached", ID: req.ID, Scrollback: scrollback})
+			var scrollback string
+			var offset uint64
+			switch req.Replay {
+			case "", "full":
+				scrollback, offset, err = sm.GetScrollback(req.ID)
+			case "screen":
+				history := defaultReplayHistory
+				if req.History != nil {
+					history = max(*req.History, 0)
+				}
+				scrollback, offset, err = sm.ScreenScrollback(req.ID, history)
+			default:
+				err = fmt.Errorf("unknown replay: %s", req.Replay)
+			}
+			if err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: req.ID})
+				continue
+			}
+			wasController := controllerOf(req.ID) == client.id
+			mode := attachClient(client, req.ID, want)
+			watchAcks(client, req.ID, req.Ack, offset)
+			err = client.sendAttached(AttachedResponse{
+				Type:       "attached",
+				ID:         req.ID,
+				Offset:     offset,
+				Mode:       string(mode),
+				Controller: controllerOf(req.ID),
+				Client:     client.id,
+			}, []byte(scrollback))
+			if err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: req.ID})
+			}
+			if wasController != (mode == modeController) {
+				notifyControl(req.ID, "")
+				rearbitrate(sm, req.ID)
+			}
 
 		case "detach":
 			var req DetachRequest
@@ -234,7 +933,36 @@ func handleClient(conn net.Conn, sm *SessionManager) {
 				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: ""})
 				continue
 			}
-			delete(client.attached, req.ID)
+			releasedControl, releasedPause := detachClient(client, req.ID)
+			if releasedControl {
+				notifyControl(req.ID, client.id)
+			}
+			if releasedPause {
+				releasePause(sm, req.ID)
+			}
+			updateFlow(sm, req.ID)
+			if size, changed, err := sm.DropClientSize(req.ID, client.id, controllerOf(req.ID)); err == nil {
+				announceSize(req.ID, size, changed)
+			}
+
+		case "takeControl":
+			var req TakeControlRequest
+			if err := json.Unmarshal(line, &req); err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: ""})
+				continue
+			}
+			prev, err := takeControl(client, req.ID)
+			if err != nil {
+				client.Send(ErrorResponse{Type: "error", Message: err.Error(), ID: req.ID})
+				continue
+			}
+			prevID := ""
+			if prev != nil {
+				prevID = prev.id
+				slog.Info("session.control_taken", "session", req.ID, "client", client.id, "previous", prevID)
+			}
+			notifyControl(req.ID, prevID)
+			rearbitrate(sm, req.ID)
 
 		default:
 			client.Send(ErrorResponse{Type: "error", Message: "unknown type: " + peek.Type})
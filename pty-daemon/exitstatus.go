@@ -0,0 +1,26 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// exitDetail extracts how a process ended from its wait status and rusage.
+// state may be nil if Wait failed, in which case only the runtime is known.
+func exitDetail(state *os.ProcessState, startedAt, exitedAt time.Time) ExitDetail {
+	d := ExitDetail{RuntimeMs: exitedAt.Sub(startedAt).Milliseconds()}
+	if state == nil {
+		return d
+	}
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		d.Signal = signalName(ws.Signal())
+		d.CoreDumped = ws.CoreDump()
+	}
+	d.UserCPUMs = state.UserTime().Milliseconds()
+	d.SysCPUMs = state.SystemTime().Milliseconds()
+	if ru, ok := state.SysUsage().(*syscall.Rusage); ok {
+		d.MaxRSSBytes = maxRSSBytes(ru)
+	}
+	return d
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// exitOf runs script as a session and returns the ExitDetail reported for it.
+func exitOf(t *testing.T, id, script string) ExitDetail {
+	t.Helper()
+	exits := make(chan ExitDetail, 1)
+	sm := NewSessionManager(func(string, string, uint64) {}, func(_ string, _ int, _ int, d ExitDetail) {
+		exits <- d
+	})
+	startTestSession(t, sm, id, script)
+	select {
+	case d := <-exits:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s: no exit reported", id)
+		return ExitDetail{}
+	}
+}
+
+func TestExitDetail_Killed(t *testing.T) {
+	d := exitOf(t, "x1", "sleep 0.1; kill -KILL $$")
+	if d.Signal != "SIGKILL" || d.CoreDumped {
+		t.Fatalf("expected SIGKILL without a core, got %+v", d)
+	}
+	if d.RuntimeMs < 100 || d.MaxRSSBytes <= 0 {
+		t.Fatalf("expected a runtime of at least 100ms and a max RSS, got %+v", d)
+	}
+}
+
+func TestExitDetail_AbortWithoutCore(t *testing.T) {
+	d := exitOf(t, "x2", "ulimit -c 0; kill -ABRT $$")
+	if d.Signal != "SIGABRT" {
+		t.Fatalf("expected SIGABRT, got %+v", d)
+	}
+	// A core_pattern pipe (e.g. systemd-coredump) gets the core whatever
+	// the limit, so only check the flag when cores go to a file.
+	pattern, _ := os.ReadFile("/proc/sys/kernel/core_pattern")
+	if !strings.HasPrefix(string(pattern), "|") && d.CoreDumped {
+		t.Fatalf("expected no core with ulimit -c 0, got %+v", d)
+	}
+	if d.MaxRSSBytes <= 0 {
+		t.Fatalf("expected a max RSS, got %+v", d)
+	}
+}
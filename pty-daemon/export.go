@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Colours an HTML export uses where the output leaves them at the
+// terminal's default, e.g. for reverse video.
+const (
+	exportFG = "#d4d4d4"
+	exportBG = "#1e1e1e"
+)
+
+// exportPalette is xterm's 16 standard colours; the rest of the 256 are
+// computed (see paletteColor).
+var exportPalette = [16]string{
+	"#000000", "#cd0000", "#00cd00", "#cdcd00", "#0000ee", "#cd00cd", "#00cdcd", "#e5e5e5",
+	"#7f7f7f", "#ff0000", "#00ff00", "#ffff00", "#5c5cff", "#ff00ff", "#00ffff", "#ffffff",
+}
+
+// exportRun is text written with one set of SGR attributes.
+type exportRun struct {
+	sgr  sgrState
+	text []byte
+}
+
+// flattenOutput turns terminal output into lines of styled text. It isn't
+// a terminal emulator: cursor movement is dropped, but a carriage return
+// not followed by a newline starts the line over and a backspace takes
+// back a character, which covers progress bars and line editors.
+func flattenOutput(data []byte) [][]exportRun {
+	var a ansiState
+	var lines [][]exportRun
+	var line []exportRun
+	cr := false
+	for _, b := range data {
+		if a.state != parseGround || b == 0x1b {
+			a.feed(b)
+			continue
+		}
+		if cr && b != '\n' {
+			line = line[:0]
+		}
+		cr = false
+		switch {
+		case b == '\n':
+			lines = append(lines, line)
+			line = nil
+		case b == '\r':
+			cr = true
+		case b == '\b':
+			if n := len(line); n > 0 {
+				_, size := utf8.DecodeLastRune(line[n-1].text)
+				line[n-1].text = line[n-1].text[:len(line[n-1].text)-size]
+				if len(line[n-1].text) == 0 {
+					line = line[:n-1]
+				}
+			}
+		case b < 0x20 && b != '\t', b == 0x7f:
+			// Other controls (BEL, SI/SO, …) don't print.
+		default:
+			if n := len(line); n > 0 && line[n-1].sgr == a.sgr {
+				line[n-1].text = append(line[n-1].text, b)
+			} else {
+				line = append(line, exportRun{sgr: a.sgr, text: []byte{b}})
+			}
+		}
+	}
+	if len(line) > 0 {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// renderText renders output as plain text, with escape sequences removed.
+func renderText(data []byte) []byte {
+	var out bytes.Buffer
+	for _, line := range flattenOutput(data) {
+		for _, run := range line {
+			out.Write(run.text)
+		}
+		out.WriteByte('\n')
+	}
+	return bytes.ToValidUTF8(out.Bytes(), []byte("�"))
+}
+
+// renderHTML renders output as a self-contained HTML page, keeping its
+// colours and text attributes as inline styles.
+func renderHTML(title string, data []byte) []byte {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n", html.EscapeString(title))
+	fmt.Fprintf(&out, "<style>\nbody { margin: 0; background: %s; }\n", exportBG)
+	fmt.Fprintf(&out, "pre { margin: 0; padding: 1em; color: %s; background: %s; font: 13px/1.3 ui-monospace, Menlo, Consolas, monospace; white-space: pre-wrap; overflow-wrap: anywhere; }\n", exportFG, exportBG)
+	out.WriteString("</style>\n</head>\n<body>\n<pre>")
+	for _, line := range flattenOutput(data) {
+		for _, run := range line {
+			text := html.EscapeString(strings.ToValidUTF8(string(run.text), "�"))
+			if style := run.sgr.css(); style != "" {
+				fmt.Fprintf(&out, "<span style=\"%s\">%s</span>", style, text)
+			} else {
+				out.WriteString(text)
+			}
+		}
+		out.WriteByte('\n')
+	}
+	out.WriteString("</pre>\n</body>\n</html>\n")
+	return out.Bytes()
+}
+
+// css returns inline style declarations for the state, or "" for the
+// default.
+func (s sgrState) css() string {
+	fg, bg := cssColor(s.fg), cssColor(s.bg)
+	if s.attrs[7] { // reverse video
+		fg, bg = bg, fg
+		if fg == "" {
+			fg = exportBG
+		}
+		if bg == "" {
+			bg = exportFG
+		}
+	}
+	if s.attrs[8] { // concealed
+		fg = "transparent"
+	}
+	var decls, deco []string
+	if fg != "" {
+		decls = append(decls, "color:"+fg)
+	}
+	if bg != "" {
+		decls = append(decls, "background:"+bg)
+	}
+	if s.attrs[1] {
+		decls = append(decls, "font-weight:bold")
+	}
+	if s.attrs[2] {
+		decls = append(decls, "opacity:0.6")
+	}
+	if s.attrs[3] {
+		decls = append(decls, "font-style:italic")
+	}
+	if s.underline != "" {
+		deco = append(deco, "underline")
+		switch s.underline {
+		case "21", "4:2":
+			decls = append(decls, "text-decoration-style:double")
+		case "4:3":
+			decls = append(decls, "text-decoration-style:wavy")
+		case "4:4":
+			decls = append(decls, "text-decoration-style:dotted")
+		case "4:5":
+			decls = append(decls, "text-decoration-style:dashed")
+		}
+		if c := cssColor(s.ulColor); c != "" {
+			decls = append(decls, "text-decoration-color:"+c)
+		}
+	}
+	if s.attrs[9] {
+		deco = append(deco, "line-through")
+	}
+	if len(deco) > 0 {
+		decls = append(decls, "text-decoration-line:"+strings.Join(deco, " "))
+	}
+	return strings.Join(decls, ";")
+}
+
+// cssColor turns the SGR parameters that set a colour (as sgrState keeps
+// them) into a CSS colour, or "" for the default or anything unreadable.
+func cssColor(param string) string {
+	if param == "" {
+		return ""
+	}
+	tokens := strings.FieldsFunc(param, func(r rune) bool { return r == ';' || r == ':' })
+	if len(tokens) == 0 {
+		return ""
+	}
+	head, err := strconv.Atoi(tokens[0])
+	if err != nil {
+		return ""
+	}
+	switch {
+	case head >= 30 && head <= 37:
+		return exportPalette[head-30]
+	case head >= 40 && head <= 47:
+		return exportPalette[head-40]
+	case head >= 90 && head <= 97:
+		return exportPalette[head-90+8]
+	case head >= 100 && head <= 107:
+		return exportPalette[head-100+8]
+	case len(tokens) >= 3 && tokens[1] == "5":
+		if n, err := strconv.Atoi(tokens[2]); err == nil && n >= 0 && n < 256 {
+			return paletteColor(n)
+		}
+	case len(tokens) >= 5 && tokens[1] == "2":
+		// The last three are r, g, b: a colour-space ID may come first
+		// in the colon form (38:2::r:g:b has an empty one, dropped above).
+		rgb := tokens[len(tokens)-3:]
+		var c [3]int
+		for i, t := range rgb {
+			n, err := strconv.Atoi(t)
+			if err != nil || n < 0 || n > 255 {
+				return ""
+			}
+			c[i] = n
+		}
+		return fmt.Sprintf("#%02x%02x%02x", c[0], c[1], c[2])
+	}
+	return ""
+}
+
+// paletteColor returns colour n of xterm's 256: the 16 standard colours,
+// a 6×6×6 cube, then 24 greys.
+func paletteColor(n int) string {
+	switch {
+	case n < 16:
+		return exportPalette[n]
+	case n < 232:
+		n -= 16
+		level := func(v int) int {
+			if v == 0 {
+				return 0
+			}
+			return 55 + 40*v
+		}
+		return fmt.Sprintf("#%02x%02x%02x", level(n/36), level(n/6%6), level(n%6))
+	default:
+		g := 8 + 10*(n-232)
+		return fmt.Sprintf("#%02x%02x%02x", g, g, g)
+	}
+}
+
+// exportOutput renders part of a session's output for an ExportRequest.
+func exportOutput(sm *SessionManager, req ExportRequest) (ExportResponse, error) {
+	out, err := sm.Output(req.ID, req.OutputRange)
+	if err != nil {
+		return ExportResponse{}, err
+	}
+	var rendered []byte
+	switch req.Format {
+	case "", "text":
+		req.Format = "text"
+		rendered = renderText([]byte(out.Data))
+	case "html":
+		rendered = renderHTML(req.ID, []byte(out.Data))
+	default:
+		return ExportResponse{}, fmt.Errorf("format must be text or html, not %q", req.Format)
+	}
+	return ExportResponse{
+		Type:   "exported",
+		ID:     req.ID,
+		Format: req.Format,
+		From:   out.From,
+		To:     out.To,
+		Since:  out.Since,
+		Until:  out.Until,
+		Size:   len(rendered),
+		Data:   string(rendered),
+	}, nil
+}
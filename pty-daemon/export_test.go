@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderText(t *testing.T) {
+	out := "$ ls\r\n\x1b[1;34mdir\x1b[0m  file\r\n" +
+		"\x1b]0;title\x07" + // window title
+		"10%\r50%\r100%\r\n" + // progress bar
+		"tpyo\b\b\bypo\r\n" +
+		"\x1b[?2004h$ "
+	want := "$ ls\ndir  file\n100%\ntypo\n$ \n"
+	if got := string(renderText([]byte(out))); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestRenderHTML(t *testing.T) {
+	out := "<b>\x1b[31mred\x1b[1;48;5;21m bold\x1b[0m & \x1b[7mrev\x1b[27;38:2::1:2:3m rgb\r\n"
+	got := string(renderHTML("a<b", []byte(out)))
+	for _, want := range []string{
+		"<title>a&lt;b</title>",
+		"&lt;b&gt;",
+		`<span style="color:#cd0000">red</span>`,
+		`<span style="color:#cd0000;background:#0000ff;font-weight:bold"> bold</span> &amp; `,
+		`<span style="color:#1e1e1e;background:#d4d4d4">rev</span>`,
+		`<span style="color:#010203"> rgb</span>` + "\n</pre>",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "\x1b") {
+		t.Error("escape sequences left in the HTML")
+	}
+}
+
+func TestCSSColor(t *testing.T) {
+	cases := map[string]string{
+		"":                "",
+		"32":              "#00cd00",
+		"97":              "#ffffff",
+		"104":             "#5c5cff",
+		"38;5;9":          "#ff0000",
+		"38;5;16":         "#000000",
+		"38;5;208":        "#ff8700",
+		"48;5;244":        "#808080",
+		"38;2;255;128;0":  "#ff8000",
+		"38:2::255:128:0": "#ff8000",
+		"38:2:1:0:0:255":  "#0000ff",
+		"38;2;300;0;0":    "",
+		"38;5":            "",
+	}
+	for in, want := range cases {
+		if got := cssColor(in); got != want {
+			t.Errorf("%q: got %q, want %q", in, got, want)
+		}
+	}
+}
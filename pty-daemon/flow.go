@@ -0,0 +1,178 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// flowGate holds a session's reader while output is paused. With nobody
+// reading the PTY, the kernel's buffer fills and the process blocks in
+// write, which is the only backpressure a terminal program understands.
+//
+// A session is paused by request, or automatically while a client that
+// acknowledges output falls too far behind. Either keeps it paused.
+type flowGate struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	manual   bool
+	auto     bool
+	released bool // the session is going away and must be read to EOF
+}
+
+func newFlowGate() *flowGate {
+	g := &flowGate{}
+	g.cond = sync.NewCond(&g.mu)
+	return g
+}
+
+// wait blocks while the gate is paused.
+func (g *flowGate) wait() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for (g.manual || g.auto) && !g.released {
+		g.cond.Wait()
+	}
+}
+
+// set changes one of the pause sources and reports whether that changed
+// whether the session is paused, and what it is now.
+func (g *flowGate) set(auto, on bool) (changed, paused bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	was := g.pausedLocked()
+	if auto {
+		g.auto = on
+	} else {
+		g.manual = on
+	}
+	paused = g.pausedLocked()
+	if !paused {
+		g.cond.Broadcast()
+	}
+	return paused != was, paused
+}
+
+func (g *flowGate) paused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.pausedLocked()
+}
+
+func (g *flowGate) pausedLocked() bool {
+	return (g.manual || g.auto) && !g.released
+}
+
+// release opens the gate for good.
+func (g *flowGate) release() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.released = true
+	g.cond.Broadcast()
+}
+
+// watchAcks starts or stops counting a client's acknowledgements for a
+// session, starting from offset, the output it was attached at.
+func watchAcks(c *Client, sessionID string, on bool, offset uint64) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	if on {
+		c.acks[sessionID] = offset
+	} else {
+		delete(c.acks, sessionID)
+	}
+}
+
+// setAcked records the output offset a client has consumed. It is ignored
+// for sessions the client didn't attach to with acknowledgements on, and
+// offsets only move forward.
+func setAcked(c *Client, sessionID string, offset uint64) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	if acked, ok := c.acks[sessionID]; ok && offset > acked {
+		c.acks[sessionID] = offset
+	}
+}
+
+// ackLag returns how far the slowest acknowledging client attached to a
+// session is behind sent, and whether there are any.
+func ackLag(sessionID string, sent uint64) (uint64, bool) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	var lag uint64
+	acking := false
+	for c := range clients {
+		acked, ok := c.acks[sessionID]
+		if !ok {
+			continue
+		}
+		acking = true
+		if sent > acked && sent-acked > lag {
+			lag = sent - acked
+		}
+	}
+	return lag, acking
+}
+
+// holdPause records that c paused a session by request, or on a resume
+// forgets every client's pause: whoever resumes speaks for everyone.
+func holdPause(c *Client, sessionID string, on bool) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	if on {
+		c.pauses[sessionID] = true
+		return
+	}
+	for other := range clients {
+		delete(other.pauses, sessionID)
+	}
+}
+
+// pauseHeldLocked reports whether any client holds a session paused.
+// Caller holds clientsMu.
+func pauseHeldLocked(sessionID string) bool {
+	for c := range clients {
+		if c.pauses[sessionID] {
+			return true
+		}
+	}
+	return false
+}
+
+// releasePause lifts a session's requested pause once the clients that
+// asked for it have gone, so a client that disconnects mid-pause can't
+// leave the session stalled for good.
+func releasePause(sm *SessionManager, sessionID string) {
+	if changed, paused, err := sm.Pause(sessionID, false, false); err == nil && changed {
+		slog.Info("session.resumed", "session", sessionID, "reason", "pauser_detached")
+		announceFlow(sessionID, paused)
+	}
+}
+
+// updateFlow pauses a session once an acknowledging client is more than
+// flowHighWater bytes behind, and resumes it when every such client is
+// within flowLowWater, telling attached clients of any change.
+func updateFlow(sm *SessionManager, sessionID string) {
+	sent, err := sm.OutputOffset(sessionID)
+	if err != nil {
+		return
+	}
+	cfg := currentConfig()
+	lag, acking := ackLag(sessionID, sent)
+	var pause bool
+	switch {
+	case acking && lag > uint64(cfg.FlowHighWater):
+		pause = true
+	case !acking || lag <= uint64(cfg.FlowLowWater):
+		pause = false
+	default:
+		return // in between: stay as we are
+	}
+	if changed, paused, err := sm.Pause(sessionID, true, pause); err == nil && changed {
+		announceFlow(sessionID, paused)
+	}
+}
+
+// announceFlow tells attached clients a session was paused or resumed.
+func announceFlow(sessionID string, paused bool) {
+	broadcastToAttached(sessionID, FlowEvent{Type: "flow", ID: sessionID, Paused: paused})
+}
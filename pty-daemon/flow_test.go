@@ -0,0 +1,136 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFlowGate_PausedWhileEitherWants(t *testing.T) {
+	g := newFlowGate()
+	if changed, paused := g.set(false, true); !changed || !paused {
+		t.Fatal("manual pause should pause")
+	}
+	if changed, _ := g.set(true, true); changed {
+		t.Fatal("auto pause on top of manual shouldn't change anything")
+	}
+	if changed, paused := g.set(false, false); changed || !paused {
+		t.Fatal("still paused for the auto source")
+	}
+
+	passed := make(chan struct{})
+	go func() {
+		g.wait()
+		close(passed)
+	}()
+	select {
+	case <-passed:
+		t.Fatal("wait returned while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if changed, paused := g.set(true, false); !changed || paused {
+		t.Fatal("clearing the last source should resume")
+	}
+	<-passed
+}
+
+func TestFlowGate_Release(t *testing.T) {
+	g := newFlowGate()
+	g.set(false, true)
+	g.release()
+	g.wait()
+	if g.paused() {
+		t.Fatal("a released gate should never report paused")
+	}
+}
+
+func TestAckLag(t *testing.T) {
+	a := &Client{acks: map[string]uint64{"s": 1000}}
+	b := &Client{acks: map[string]uint64{"s": 4000}}
+	c := &Client{acks: map[string]uint64{}}
+	clientsMu.Lock()
+	clients[a], clients[b], clients[c] = true, true, true
+	clientsMu.Unlock()
+	t.Cleanup(func() {
+		clientsMu.Lock()
+		delete(clients, a)
+		delete(clients, b)
+		delete(clients, c)
+		clientsMu.Unlock()
+	})
+
+	if lag, acking := ackLag("s", 5000); !acking || lag != 4000 {
+		t.Fatalf("expected the slowest client's lag of 4000, got %d (%v)", lag, acking)
+	}
+	setAcked(a, "s", 500) // backwards: ignored
+	setAcked(a, "s", 4500)
+	setAcked(c, "s", 5000) // not acking this session: ignored
+	if lag, _ := ackLag("s", 5000); lag != 1000 {
+		t.Fatalf("expected a lag of 1000 after acks, got %d", lag)
+	}
+	if _, acking := ackLag("other", 5000); acking {
+		t.Fatal("nobody acks session other")
+	}
+}
+
+func TestSessionManager_PauseStopsReading(t *testing.T) {
+	t.Setenv("SPACETERM_HOME", t.TempDir())
+	sm := newTestManager()
+	startTestSession(t, sm, "p", "while :; do echo flood; done")
+
+	if _, _, err := sm.Pause("p", false, true); err != nil {
+		t.Fatal(err)
+	}
+	// Let the read that was already under way, and its batch, finish.
+	time.Sleep(200 * time.Millisecond)
+	before, _ := sm.OutputOffset("p")
+	time.Sleep(200 * time.Millisecond)
+	if after, _ := sm.OutputOffset("p"); after != before {
+		t.Fatalf("output kept coming while paused: %d → %d", before, after)
+	}
+	if info := sm.List(); len(info) != 1 || !info[0].Paused {
+		t.Fatal("expected the session to be listed as paused")
+	}
+
+	sm.Pause("p", false, false)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if after, _ := sm.OutputOffset("p"); after > before {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("output didn't resume")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestDetach_ReleasesPauseWithItsLastHolder(t *testing.T) {
+	sm := newTestManager()
+	startTestSession(t, sm, "p2", "sleep 5")
+	a, b := newTestClient("a"), newTestClient("b")
+	defer dropTestClient(a)
+	defer dropTestClient(b)
+
+	for _, c := range []*Client{a, b} {
+		sm.Pause("p2", false, true)
+		holdPause(c, "p2", true)
+	}
+	if _, releasedPause := detachClient(a, "p2"); releasedPause {
+		t.Fatal("b still holds the pause")
+	}
+	_, unpaused := detachAll(b)
+	if len(unpaused) != 1 || unpaused[0] != "p2" {
+		t.Fatalf("expected b's pause of p2 released, got %v", unpaused)
+	}
+	releasePause(sm, "p2")
+	if info := sm.List(); len(info) != 1 || info[0].Paused {
+		t.Fatal("expected the session to be resumed")
+	}
+
+	// A resume by anyone clears every holder.
+	holdPause(a, "p2", true)
+	holdPause(b, "p2", false)
+	if _, releasedPause := detachClient(a, "p2"); releasedPause {
+		t.Fatal("a's pause should have been cleared by the resume")
+	}
+}
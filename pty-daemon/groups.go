@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+)
+
+func groupsPath() string { return filepath.Join(socketDir(), "groups.json") }
+
+// groupStore holds named session groups: ordered lists of session IDs that
+// writeMany can target by name. Members are kept by ID whether or not the
+// session currently exists, so a group survives its sessions being
+// resurrected. Groups are saved to disk on every change.
+type groupStore struct {
+	mu     sync.Mutex
+	path   string // empty: in memory only
+	groups map[string][]string
+}
+
+// groups is the daemon's group store.
+var groups = &groupStore{groups: make(map[string][]string)}
+
+// load reads the saved groups. A missing file is an empty store.
+func (g *groupStore) load(path string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.path = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &g.groups)
+}
+
+// update applies a group request and returns the resulting members. A
+// group left empty is deleted.
+func (g *groupStore) update(req GroupRequest) ([]string, error) {
+	if req.Name == "" {
+		return nil, fmt.Errorf("group name is required")
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	members := g.groups[req.Name]
+	if req.Set != nil {
+		members = nil
+		for _, id := range req.Set {
+			if !slices.Contains(members, id) {
+				members = append(members, id)
+			}
+		}
+	} else {
+		members = slices.Clone(members)
+	}
+	for _, id := range req.Add {
+		if !slices.Contains(members, id) {
+			members = append(members, id)
+		}
+	}
+	members = slices.DeleteFunc(members, func(id string) bool { return slices.Contains(req.Remove, id) })
+
+	if len(members) == 0 {
+		delete(g.groups, req.Name)
+	} else {
+		g.groups[req.Name] = members
+	}
+	if err := g.save(); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// save writes the store out. Caller holds g.mu.
+func (g *groupStore) save() error {
+	if g.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(g.groups)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(g.path, data)
+}
+
+// members returns a group's session IDs, or an error if it doesn't exist.
+func (g *groupStore) members(name string) ([]string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ids, ok := g.groups[name]
+	if !ok {
+		return nil, fmt.Errorf("no such group: %s", name)
+	}
+	return slices.Clone(ids), nil
+}
+
+// all returns a copy of every group.
+func (g *groupStore) all() map[string][]string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	out := make(map[string][]string, len(g.groups))
+	for name, ids := range g.groups {
+		out[name] = slices.Clone(ids)
+	}
+	return out
+}
+
+// writeTargets resolves a writeMany request to session IDs: the explicit
+// IDs, then the group's members, then sessions matching the selector
+// sorted by ID, without duplicates.
+func writeTargets(req WriteManyRequest, sm *SessionManager) ([]string, error) {
+	var out []string
+	add := func(id string) {
+		if !slices.Contains(out, id) {
+			out = append(out, id)
+		}
+	}
+	for _, id := range req.IDs {
+		add(id)
+	}
+	if req.Group != "" {
+		ids, err := groups.members(req.Group)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			add(id)
+		}
+	}
+	if req.Selector != "" {
+		sel, err := parseSelector(req.Selector)
+		if err != nil {
+			return nil, err
+		}
+		var matched []string
+		for _, info := range sm.List() {
+			if info.Alive && sel.matches(info.Labels) {
+				matched = append(matched, info.ID)
+			}
+		}
+		sort.Strings(matched)
+		for _, id := range matched {
+			add(id)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("writeMany needs ids, a group or a selector matching something")
+	}
+	return out, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGroupStore_UpdateAndPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "groups.json")
+	g := &groupStore{groups: make(map[string][]string)}
+	if err := g.load(path); err != nil {
+		t.Fatal(err)
+	}
+	ids, err := g.update(GroupRequest{Name: "repos", Set: []string{"a", "b", "a"}, Add: []string{"c"}})
+	if err != nil || !slices.Equal(ids, []string{"a", "b", "c"}) {
+		t.Fatalf("expected [a b c], got %v, %v", ids, err)
+	}
+	ids, _ = g.update(GroupRequest{Name: "repos", Remove: []string{"b"}})
+	if !slices.Equal(ids, []string{"a", "c"}) {
+		t.Fatalf("expected [a c], got %v", ids)
+	}
+
+	reloaded := &groupStore{groups: make(map[string][]string)}
+	if err := reloaded.load(path); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := reloaded.members("repos"); !slices.Equal(got, []string{"a", "c"}) {
+		t.Fatalf("expected saved [a c], got %v", got)
+	}
+
+	g.update(GroupRequest{Name: "repos", Remove: []string{"a", "c"}})
+	if _, err := g.members("repos"); err == nil {
+		t.Fatal("an emptied group should be deleted")
+	}
+}
+
+func TestWriteMany(t *testing.T) {
+	var outMu sync.Mutex
+	out := map[string]string{}
+	sm := NewSessionManager(func(id, data string, _ uint64) {
+		outMu.Lock()
+		out[id] += data
+		outMu.Unlock()
+	}, func(string, int, int, ExitDetail) {})
+	for _, id := range []string{"w1", "w2"} {
+		startTestSession(t, sm, id, "stty -echo; cat")
+	}
+	allow := func(string) error { return nil }
+
+	res := sm.WriteMany([]string{"w2", "nope", "w1"}, "x", true, allow)
+	if res[0].ID != "w2" || res[0].OK || res[1].Error == "" || res[2].OK {
+		t.Fatalf("all-or-nothing with a missing session should send nothing: %+v", res)
+	}
+
+	time.Sleep(200 * time.Millisecond) // let stty run before sending
+	res = sm.WriteMany([]string{"w2", "nope", "w1"}, "hello\r", false, allow)
+	if !res[0].OK || res[1].OK || !res[2].OK {
+		t.Fatalf("expected w2 and w1 to succeed: %+v", res)
+	}
+	sent := make(chan []WriteResult, 1)
+	go func() { sent <- sm.WriteMany([]string{"w1", "w1", "w2"}, "again\r", false, allow) }()
+	select {
+	case res = <-sent:
+	case <-time.After(2 * time.Second):
+		t.Fatal("WriteMany deadlocked on a repeated ID")
+	}
+	if len(res) != 3 || !res[0].OK || !res[1].OK || res[1].ID != "w1" || !res[2].OK {
+		t.Fatalf("expected every target to succeed: %+v", res)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		outMu.Lock()
+		done := strings.Contains(out["w1"], "hello") && strings.Contains(out["w2"], "hello") &&
+			strings.Count(out["w1"], "again") == 1 && strings.Contains(out["w2"], "again")
+		outMu.Unlock()
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("input not delivered to both sessions: %q", out)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestWriteMany_ReachesControlledSessions(t *testing.T) {
+	var outMu sync.Mutex
+	out := map[string]string{}
+	sm := NewSessionManager(func(id, data string, _ uint64) {
+		outMu.Lock()
+		out[id] += data
+		outMu.Unlock()
+	}, func(string, int, int, ExitDetail) {})
+	for _, id := range []string{"wc1", "wc2"} {
+		startTestSession(t, sm, id, "stty -echo; cat")
+	}
+	owner, writer, watcher := newTestClient("owner"), newTestClient("writer"), newTestClient("watcher")
+	defer dropTestClient(owner)
+	defer dropTestClient(writer)
+	defer dropTestClient(watcher)
+	attachClient(owner, "wc1", modeController)
+	attachClient(watcher, "wc1", modeViewer)
+
+	time.Sleep(200 * time.Millisecond) // let stty run before sending
+	res := sm.WriteMany([]string{"wc1", "wc2"}, "broadcast\r", true, func(id string) error {
+		return checkInput(writer, id)
+	})
+	if !res[0].OK || !res[1].OK {
+		t.Fatalf("an unattached writer should reach a controlled session: %+v", res)
+	}
+	res = sm.WriteMany([]string{"wc1", "wc2"}, "x", false, func(id string) error {
+		return checkInput(watcher, id)
+	})
+	if res[0].OK || !res[1].OK {
+		t.Fatalf("a viewer should only be refused where it's a viewer: %+v", res)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		outMu.Lock()
+		done := strings.Contains(out["wc1"], "broadcast") && strings.Contains(out["wc2"], "broadcast")
+		outMu.Unlock()
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("broadcast not delivered to both sessions: %q", out)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// inputChunk is the most written to a PTY at once. It matches MAX_INPUT on
+// macOS (Linux allows 4096): a canonical-mode line discipline drops input
+// past that, and a smaller write also lets the process's reads interleave.
+const inputChunk = 1024
+
+// inputQueue buffers a session's input for its writer goroutine, so a
+// client writing to a process that isn't reading never blocks.
+type inputQueue struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	buf      []byte // pending input, oldest first
+	inFlight int    // bytes at the front of buf the writer is writing
+	dropped  int    // discarded by interrupts since buf last emptied
+	backlog  bool   // held more than a chunk since it last emptied
+	closed   bool
+}
+
+// isInterrupt reports whether data is a lone ^C, ^\ or ^Z: a keystroke
+// meant to stop whatever the input before it started.
+func isInterrupt(data []byte) bool {
+	return len(data) == 1 && (data[0] == 0x03 || data[0] == 0x1c || data[0] == 0x1a)
+}
+
+func newInputQueue() *inputQueue {
+	q := &inputQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// push queues data. If that would put more than max bytes in the queue,
+// nothing is queued, so input is never half-delivered.
+func (q *inputQueue) push(data []byte, max int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.check(data, max); err != nil {
+		return err
+	}
+	q.add(data)
+	return nil
+}
+
+// check reports whether data may be queued. An interrupt always may: it
+// empties the queue (see add), and a full one is when it's needed most.
+// Caller holds q.mu.
+func (q *inputQueue) check(data []byte, max int) error {
+	if q.closed {
+		return fmt.Errorf("session is not running")
+	}
+	if len(q.buf)+len(data) > max && !isInterrupt(data) {
+		return fmt.Errorf("input queue full: %d bytes pending, %d more would exceed %d",
+			len(q.buf), len(data), max)
+	}
+	return nil
+}
+
+// add queues data and wakes the writer. An interrupt discards whatever is
+// queued but not yet being written, as the terminal discards its own input
+// on ^C, so it isn't stuck behind a paste and doesn't let the rest of the
+// paste run after it. Caller holds q.mu.
+func (q *inputQueue) add(data []byte) {
+	if isInterrupt(data) && len(q.buf) > q.inFlight {
+		q.dropped += len(q.buf) - q.inFlight
+		q.buf = q.buf[:q.inFlight:q.inFlight]
+		q.backlog = true
+	}
+	q.buf = append(q.buf, data...)
+	if len(q.buf) > inputChunk {
+		q.backlog = true
+	}
+	q.cond.Signal()
+}
+
+// Len returns the number of bytes waiting to be written.
+func (q *inputQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.buf)
+}
+
+// close stops the writer and discards anything still queued.
+func (q *inputQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.buf = nil
+	q.inFlight = 0
+	q.cond.Broadcast()
+}
+
+// run writes queued input to w a chunk at a time until the queue is closed
+// or a write fails. written is told how much each write took; drained is
+// called whenever a backlog has been fully written or discarded, which is
+// worth telling clients about, unlike every keystroke, with how many bytes
+// an interrupt discarded.
+func (q *inputQueue) run(w io.Writer, written func(int), drained func(dropped int)) {
+	chunk := make([]byte, inputChunk)
+	for {
+		q.mu.Lock()
+		for len(q.buf) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if q.closed {
+			q.mu.Unlock()
+			return
+		}
+		n := copy(chunk, q.buf)
+		q.inFlight = n
+		q.mu.Unlock()
+
+		m, err := w.Write(chunk[:n])
+		written(m)
+
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			return
+		}
+		q.buf = q.buf[m:]
+		q.inFlight = 0
+		notify, dropped := false, 0
+		if len(q.buf) == 0 {
+			q.buf = nil // let a big paste's array go
+			notify, q.backlog = q.backlog, false
+			dropped, q.dropped = q.dropped, 0
+		}
+		q.mu.Unlock()
+
+		if err != nil {
+			q.close()
+			return
+		}
+		if notify {
+			drained(dropped)
+		}
+	}
+}
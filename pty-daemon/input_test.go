@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// chunkRecorder records the size of each write.
+type chunkRecorder struct {
+	mu     sync.Mutex
+	data   bytes.Buffer
+	writes []int
+}
+
+func (r *chunkRecorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writes = append(r.writes, len(p))
+	return r.data.Write(p)
+}
+
+func TestInputQueue_RejectsOverflowWhole(t *testing.T) {
+	q := newInputQueue()
+	if err := q.push(make([]byte, 60), 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.push(make([]byte, 50), 100); err == nil {
+		t.Fatal("expected error past max")
+	}
+	if q.Len() != 60 {
+		t.Fatalf("rejected input must not be queued, have %d bytes", q.Len())
+	}
+}
+
+func TestInputQueue_ChunksAndDrains(t *testing.T) {
+	q := newInputQueue()
+	rec := &chunkRecorder{}
+	drained := make(chan struct{}, 4)
+	go q.run(rec, func(int) {}, func(int) { drained <- struct{}{} })
+	defer q.close()
+
+	paste := strings.Repeat("x", 5*inputChunk+10)
+	if err := q.push([]byte(paste), 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-drained:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no drained notification after a backlog")
+	}
+	rec.mu.Lock()
+	if rec.data.String() != paste {
+		t.Fatal("input was not written intact")
+	}
+	for _, n := range rec.writes {
+		if n > inputChunk {
+			t.Fatalf("write of %d bytes exceeds the chunk size", n)
+		}
+	}
+	rec.mu.Unlock()
+
+	// A keystroke isn't a backlog and shouldn't produce a notification.
+	q.push([]byte("a"), 1<<20)
+	select {
+	case <-drained:
+		t.Fatal("unexpected drained notification for a small write")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestInputQueue_StalledReaderDoesNotBlockPush(t *testing.T) {
+	q := newInputQueue()
+	pr, pw := io.Pipe() // nothing reads pr, so the writer stalls
+	defer pr.Close()
+	go q.run(pw, func(int) {}, func(int) {})
+	defer q.close()
+
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		for i := 0; i < 10 && err == nil; i++ {
+			err = q.push(make([]byte, 10*1024), 1<<20)
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("push blocked behind a stalled writer")
+	}
+}
+
+func TestInputQueue_InterruptDiscardsQueuedInput(t *testing.T) {
+	q := newInputQueue()
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	drained := make(chan int, 1)
+	go q.run(pw, func(int) {}, func(dropped int) { drained <- dropped })
+	defer q.close()
+
+	paste := strings.Repeat("x", 10*inputChunk)
+	if err := q.push([]byte(paste), len(paste)); err != nil {
+		t.Fatal(err)
+	}
+	// Take part of the first chunk so the writer is mid-write, then
+	// interrupt with the queue full.
+	first := make([]byte, 10)
+	if _, err := io.ReadFull(pr, first); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.push([]byte{0x03}, len(paste)); err != nil {
+		t.Fatalf("an interrupt should be queued even when the queue is full: %v", err)
+	}
+	rest := make([]byte, inputChunk-len(first)+1)
+	if _, err := io.ReadFull(pr, rest); err != nil {
+		t.Fatal(err)
+	}
+	if rest[len(rest)-1] != 0x03 {
+		t.Fatalf("expected ^C right after the chunk being written, got %q", rest[len(rest)-1])
+	}
+	select {
+	case dropped := <-drained:
+		if dropped != len(paste)-inputChunk {
+			t.Fatalf("expected %d bytes dropped, got %d", len(paste)-inputChunk, dropped)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no drained notification after the interrupt")
+	}
+	if q.Len() != 0 {
+		t.Fatalf("expected an empty queue, have %d bytes", q.Len())
+	}
+}
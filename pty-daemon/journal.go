@@ -0,0 +1,414 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// journalDir holds one entry per session so sessions can be resurrected
+// after the daemon or the machine goes down.
+func journalDir() string { return filepath.Join(socketDir(), "sessions") }
+
+// JournalEntry is what the daemon remembers about a session on disk:
+// enough to spawn it again, plus how it ended.
+type JournalEntry struct {
+	Request   CreateRequest `json:"request"`
+	LastCwd   string        `json:"lastCwd,omitempty"`
+	CreatedAt int64         `json:"createdAt"` // unix ms
+	UpdatedAt int64         `json:"updatedAt"` // last write; crash losses are at most this stale
+	ExitedAt  int64         `json:"exitedAt,omitempty"`
+	ExitCode  int           `json:"exitCode,omitempty"`
+	StoppedAt int64         `json:"stoppedAt,omitempty"` // the daemon shut down under it
+	Restored  int           `json:"restored,omitempty"`  // times resurrected
+}
+
+// reason says how a journaled session ended: "stopped" by a daemon
+// shutdown, "exited" on its own, or "lost" when the daemon died without
+// recording anything (a crash or power loss).
+func (e JournalEntry) reason() string {
+	switch {
+	case e.StoppedAt != 0:
+		return "stopped"
+	case e.ExitedAt != 0:
+		return "exited"
+	}
+	return "lost"
+}
+
+// endedAt is the last moment the session is known to have existed.
+func (e JournalEntry) endedAt() int64 { return max(e.ExitedAt, e.StoppedAt, e.UpdatedAt) }
+
+// journal stores entries as <id>.json next to a <id>.scrollback snapshot.
+type journal struct {
+	dir string
+	mu  sync.Mutex // serialises writes against removal
+}
+
+func openJournal(dir string) (*journal, error) {
+	if err := ensurePrivateDir(dir); err != nil {
+		return nil, err
+	}
+	return &journal{dir: dir}, nil
+}
+
+// path escapes the session ID so it can't name a file outside dir.
+func (j *journal) path(id, ext string) string {
+	return filepath.Join(j.dir, url.PathEscape(id)+ext)
+}
+
+// save writes an entry and, if scrollback is non-nil, replaces its
+// snapshot with it. Caller holds j.mu.
+func (j *journal) save(e JournalEntry, scrollback []byte) error {
+	if scrollback != nil {
+		if err := writeFileAtomic(j.path(e.Request.ID, ".scrollback"), scrollback); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(j.path(e.Request.ID, ".json"), data)
+}
+
+// appendScrollback adds output to a session's snapshot and returns the
+// file's new size. A crash mid-append can leave part of data at the end,
+// which is harmless in a terminal's output. Caller holds j.mu.
+func (j *journal) appendScrollback(id string, data []byte) (int64, error) {
+	f, err := os.OpenFile(j.path(id, ".scrollback"), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		return 0, err
+	}
+	if err := f.Sync(); err != nil {
+		return 0, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+// remove forgets a session. Caller holds j.mu.
+func (j *journal) remove(id string) {
+	os.Remove(j.path(id, ".json"))
+	os.Remove(j.path(id, ".scrollback"))
+}
+
+func (j *journal) load(id string) (JournalEntry, error) {
+	var e JournalEntry
+	data, err := os.ReadFile(j.path(id, ".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return e, fmt.Errorf("no journal entry for session: %s", id)
+	}
+	if err != nil {
+		return e, err
+	}
+	return e, json.Unmarshal(data, &e)
+}
+
+// scrollback returns the last snapshot, or nil if there is none. Appends
+// let it grow past a ring's worth (see checkpointSession); the ring it is
+// restored into keeps the newest part.
+func (j *journal) scrollback(id string) []byte {
+	data, _ := os.ReadFile(j.path(id, ".scrollback"))
+	return data
+}
+
+// entries returns every readable entry. Corrupt ones are skipped: a torn
+// write can't happen, but a hand-edited file can.
+func (j *journal) entries() []JournalEntry {
+	names, _ := filepath.Glob(filepath.Join(j.dir, "*.json"))
+	out := make([]JournalEntry, 0, len(names))
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			continue
+		}
+		var e JournalEntry
+		if json.Unmarshal(data, &e) == nil && e.Request.ID != "" {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// writeFileAtomic replaces path with data so a crash leaves either the old
+// or the new file, never a torn one. The data is synced first because
+// surviving a power loss is the point of the journal.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // no-op after a successful rename
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// restoredPreface is what a resurrected session's scrollback starts with:
+// the old output, then a marker. Modes the old output may have left on
+// (alternate screen, hidden cursor, colours) are reset first so the new
+// shell starts on a normal screen.
+func restoredPreface(old []byte, at time.Time) []byte {
+	var b strings.Builder
+	b.Write(old)
+	b.WriteString("\x1b[?1049l\x1b[?25h\x1b[0m\r\n")
+	b.WriteString("\x1b[2m─── session restored " + at.Format("2006-01-02 15:04:05") + " ───\x1b[0m\r\n")
+	return []byte(b.String())
+}
+
+// journalEntry stamps and returns a session's entry, or false if it has
+// been destroyed and shouldn't be written.
+func (s *Session) journalEntry() (JournalEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.journaled {
+		return JournalEntry{}, false
+	}
+	s.entry.UpdatedAt = time.Now().UnixMilli()
+	return s.entry, true
+}
+
+// journalSession writes a session's entry, with a full scrollback
+// snapshot if asked, unless the session has been destroyed in the
+// meantime.
+func (sm *SessionManager) journalSession(s *Session, withScrollback bool) {
+	j := sm.journal
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entry, ok := s.journalEntry()
+	if !ok {
+		return
+	}
+	var scrollback []byte
+	if withScrollback {
+		snap := s.Ring.Snapshot()
+		scrollback = snap.span(snap.start, snap.end(), false)
+		if scrollback == nil {
+			scrollback = []byte{}
+		}
+		s.journaledTo, s.journaledSize = snap.end(), int64(len(scrollback))
+	}
+	if err := j.save(entry, scrollback); err != nil {
+		slog.Warn("journal.write_failed", "session", s.ID, "err", err)
+	}
+}
+
+// checkpointSession writes a session's entry and appends the output since
+// the last write to its scrollback, so a checkpoint costs what the session
+// printed rather than a ring's worth. The snapshot is rewritten whole the
+// first time, once appends have doubled it past the ring's size, or when
+// output the file lacks has already left the ring.
+func (sm *SessionManager) checkpointSession(s *Session) {
+	j := sm.journal
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entry, ok := s.journalEntry()
+	if !ok {
+		return
+	}
+	tail, ok := s.Ring.Since(s.journaledTo)
+	if !ok || s.journaledSize < 0 || s.journaledSize+int64(len(tail)) > 2*int64(s.Ring.Cap()) {
+		snap := s.Ring.Snapshot()
+		scrollback := snap.span(snap.start, snap.end(), false)
+		if scrollback == nil {
+			scrollback = []byte{}
+		}
+		s.journaledTo, s.journaledSize = snap.end(), int64(len(scrollback))
+		if err := j.save(entry, scrollback); err != nil {
+			slog.Warn("journal.write_failed", "session", s.ID, "err", err)
+		}
+		return
+	}
+	if len(tail) > 0 {
+		size, err := j.appendScrollback(s.ID, tail)
+		if err != nil {
+			slog.Warn("journal.write_failed", "session", s.ID, "err", err)
+			s.journaledSize = -1 // rewrite it whole next time
+			return
+		}
+		s.journaledTo += uint64(len(tail))
+		s.journaledSize = size
+	}
+	if err := j.save(entry, nil); err != nil {
+		slog.Warn("journal.write_failed", "session", s.ID, "err", err)
+	}
+}
+
+// unjournal forgets a session on disk; used when a client destroys it,
+// since a deliberately closed session shouldn't come back.
+func (sm *SessionManager) unjournal(s *Session) {
+	j := sm.journal
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	s.mu.Lock()
+	s.journaled = false
+	s.mu.Unlock()
+	j.remove(s.ID)
+}
+
+// Checkpoint journals each live session that produced output since its
+// last write: its new output, its current directory and a fresh
+// UpdatedAt. That bounds what a crash or power loss can lose to one
+// interval. Idle sessions cost nothing, not even a cwd lookup, since
+// changing directory in a shell prints a prompt.
+func (sm *SessionManager) Checkpoint() {
+	if sm.journal == nil {
+		return
+	}
+	sm.mu.RLock()
+	sessions := make([]*Session, 0, len(sm.sessions))
+	for _, s := range sm.sessions {
+		sessions = append(sessions, s)
+	}
+	sm.mu.RUnlock()
+
+	for _, s := range sessions {
+		s.mu.Lock()
+		alive, pid, lastCwd := s.Alive, s.Pid, s.entry.LastCwd
+		s.mu.Unlock()
+		if !alive {
+			continue
+		}
+		sm.journal.mu.Lock()
+		active := s.Ring.Offset() != s.journaledTo
+		sm.journal.mu.Unlock()
+		if !active {
+			continue
+		}
+		if cwd := procCwd(pid); cwd != "" && cwd != lastCwd {
+			s.mu.Lock()
+			s.entry.LastCwd = cwd
+			s.mu.Unlock()
+		}
+		sm.checkpointSession(s)
+	}
+}
+
+// Archived returns journaled sessions that aren't running, newest first.
+func (sm *SessionManager) Archived() []ArchivedSession {
+	if sm.journal == nil {
+		return []ArchivedSession{}
+	}
+	out := []ArchivedSession{}
+	for _, e := range sm.journal.entries() {
+		if s, err := sm.get(e.Request.ID); err == nil {
+			s.mu.Lock()
+			alive := s.Alive
+			s.mu.Unlock()
+			if alive {
+				continue
+			}
+		}
+		fi, _ := os.Stat(sm.journal.path(e.Request.ID, ".scrollback"))
+		var size int64
+		if fi != nil {
+			size = fi.Size()
+		}
+		out = append(out, ArchivedSession{
+			ID:              e.Request.ID,
+			Command:         e.Request.Command,
+			Args:            e.Request.Args,
+			Cwd:             e.Request.Cwd,
+			LastCwd:         e.LastCwd,
+			Name:            e.Request.Name,
+			Labels:          e.Request.Labels,
+			Metadata:        e.Request.Metadata,
+			Reason:          e.reason(),
+			CreatedAt:       e.CreatedAt,
+			EndedAt:         e.endedAt(),
+			ExitCode:        e.ExitCode,
+			ScrollbackBytes: size,
+			Restored:        e.Restored,
+		})
+	}
+	slices.SortFunc(out, func(a, b ArchivedSession) int { return cmp.Compare(b.EndedAt, a.EndedAt) })
+	return out
+}
+
+// Resurrect respawns a journaled session that isn't running, with the
+// same command, environment and labels, in its last known directory. Its
+// scrollback starts with the old output and a "session restored" marker.
+// cols and rows override the journaled size when non-zero.
+func (sm *SessionManager) Resurrect(id string, cols, rows int) (*Session, error) {
+	if sm.journal == nil {
+		return nil, errors.New("session journal is disabled")
+	}
+	if s, err := sm.get(id); err == nil {
+		s.mu.Lock()
+		alive := s.Alive
+		s.mu.Unlock()
+		if alive {
+			return nil, fmt.Errorf("session is running: %s", id)
+		}
+	}
+	entry, err := sm.journal.load(id)
+	if err != nil {
+		return nil, err
+	}
+	req := entry.Request
+	if entry.LastCwd != "" {
+		if fi, err := os.Stat(entry.LastCwd); err == nil && fi.IsDir() {
+			req.Cwd = entry.LastCwd
+		}
+	}
+	if cols > 0 && rows > 0 {
+		req.Cols, req.Rows = cols, rows
+	}
+	preface := restoredPreface(sm.journal.scrollback(id), time.Now())
+	return sm.create(req, preface, entry.Restored+1)
+}
+
+// PruneJournal removes entries for sessions that aren't running and
+// haven't been written for longer than maxAge. Zero keeps them forever.
+func (sm *SessionManager) PruneJournal(maxAge time.Duration) int {
+	if sm.journal == nil || maxAge <= 0 {
+		return 0
+	}
+	cutoff := time.Now().Add(-maxAge).UnixMilli()
+	pruned := 0
+	for _, a := range sm.Archived() {
+		if a.EndedAt >= cutoff {
+			continue
+		}
+		sm.journal.mu.Lock()
+		// Re-check under the lock: it may have been resurrected since.
+		if e, err := sm.journal.load(a.ID); err == nil && e.endedAt() < cutoff {
+			sm.journal.remove(a.ID)
+			pruned++
+		}
+		sm.journal.mu.Unlock()
+	}
+	return pruned
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJournalEntry_Reason(t *testing.T) {
+	if got := (JournalEntry{UpdatedAt: 1}).reason(); got != "lost" {
+		t.Errorf("expected lost, got %s", got)
+	}
+	if got := (JournalEntry{ExitedAt: 1}).reason(); got != "exited" {
+		t.Errorf("expected exited, got %s", got)
+	}
+	// A shutdown hangs sessions up, so they also exit; stopped wins.
+	if got := (JournalEntry{ExitedAt: 2, StoppedAt: 1}).reason(); got != "stopped" {
+		t.Errorf("expected stopped, got %s", got)
+	}
+}
+
+func TestJournal_PathStaysInDir(t *testing.T) {
+	j := &journal{dir: "/j"}
+	if got := j.path("../../etc/passwd", ".json"); !strings.HasPrefix(got, "/j/") || strings.Count(got, "/") != 2 {
+		t.Fatalf("escaped the journal dir: %s", got)
+	}
+}
+
+func TestResurrect_RestoresScrollbackAndCwd(t *testing.T) {
+	j, err := openJournal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	exited := make(chan struct{}, 1)
+	sm := NewSessionManager(func(string, string, uint64) {}, func(string, int, int, ExitDetail) { exited <- struct{}{} })
+	sm.UseJournal(j)
+
+	dir := t.TempDir()
+	startTestSession(t, sm, "r1", "cd "+dir+" && echo before-crash && sleep 0.5", func(req *CreateRequest) {
+		req.Labels = map[string]string{"project": "demo"}
+	})
+	// Let the shell cd, then checkpoint as the daemon would.
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		sm.Checkpoint()
+		e, _ := j.load("r1")
+		if e.LastCwd == dir && strings.Contains(string(j.scrollback("r1")), "before-crash") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("checkpoint never caught the cwd and output: %+v %q", e, j.scrollback("r1"))
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if _, err := sm.Resurrect("r1", 0, 0); err == nil {
+		t.Fatal("resurrecting a running session should fail")
+	}
+
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("session did not exit")
+	}
+	archived := sm.Archived()
+	if len(archived) != 1 || archived[0].Reason != "exited" || archived[0].Labels["project"] != "demo" {
+		t.Fatalf("unexpected archive: %+v", archived)
+	}
+
+	sess, err := sm.Resurrect("r1", 100, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sess.Cmd.Dir != dir || sess.Cols != 100 {
+		t.Fatalf("expected cwd %s and 100 cols, got %s and %d", dir, sess.Cmd.Dir, sess.Cols)
+	}
+	back, _, _ := sm.GetScrollback("r1")
+	old, marker := strings.Index(back, "before-crash"), strings.Index(back, "session restored")
+	if old < 0 || marker < old {
+		t.Fatalf("expected old output above the marker, got %q", back)
+	}
+	if e, _ := j.load("r1"); e.Restored != 1 {
+		t.Fatalf("expected restored count 1, got %d", e.Restored)
+	}
+
+	sm.Destroy("r1")
+	if _, err := j.load("r1"); err == nil {
+		t.Fatal("destroy should remove the journal entry")
+	}
+}
+
+func TestResurrect_AfterCrashRestoresCheckpointedOutput(t *testing.T) {
+	dir := t.TempDir()
+	j, err := openJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm := newTestManager()
+	sm.UseJournal(j)
+	startTestSession(t, sm, "c1", "echo first-line; sleep 0.3; echo second-line; sleep 30")
+	// Checkpoint until both lines are journaled; the second is appended
+	// to what the first checkpoint wrote.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		sm.Checkpoint()
+		back := string(j.scrollback("c1"))
+		if strings.Contains(back, "first-line") && strings.Contains(back, "second-line") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("checkpoints never caught both lines, journaled %q", back)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// A daemon that crashed never shut its sessions down; the next one
+	// only has the journal to go on.
+	j2, err := openJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm2 := newTestManager()
+	sm2.UseJournal(j2)
+	archived := sm2.Archived()
+	if len(archived) != 1 || archived[0].ID != "c1" || archived[0].Reason != "lost" {
+		t.Fatalf("expected c1 archived as lost, got %+v", archived)
+	}
+	if _, err := sm2.Resurrect("c1", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer sm2.Destroy("c1")
+	back, _, _ := sm2.GetScrollback("c1")
+	first, second := strings.Index(back, "first-line"), strings.Index(back, "second-line")
+	if first < 0 || second < first {
+		t.Fatalf("expected both lines restored in order, got %q", back)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// keyModifiers are the prefixes a key name may carry, tmux style:
+// "C-c", "M-x", "S-Up", "C-M-Left".
+type keyModifiers struct {
+	ctrl, meta, shift bool
+}
+
+// xtermParam is the modifier parameter xterm puts in CSI 1;Pm X and
+// CSI n;Pm ~ sequences, or 1 for none.
+func (m keyModifiers) xtermParam() int {
+	p := 1
+	if m.shift {
+		p += 1
+	}
+	if m.meta {
+		p += 2
+	}
+	if m.ctrl {
+		p += 4
+	}
+	return p
+}
+
+// cursorKeys are keys sent as CSI/SS3 + final byte. Home and End follow
+// the cursor keys in xterm's application mode.
+var cursorKeys = map[string]byte{
+	"Up": 'A', "Down": 'B', "Right": 'C', "Left": 'D', "Home": 'H', "End": 'F',
+}
+
+// ss3Keys are F1–F4, which xterm sends as SS3 P–S when unmodified.
+var ss3Keys = map[string]byte{"F1": 'P', "F2": 'Q', "F3": 'R', "F4": 'S'}
+
+// tildeKeys are keys sent as CSI n ~.
+var tildeKeys = map[string]int{
+	"Insert": 2, "Delete": 3, "PageUp": 5, "PageDown": 6,
+	"F5": 15, "F6": 17, "F7": 18, "F8": 19, "F9": 20, "F10": 21, "F11": 23, "F12": 24,
+}
+
+// plainKeys are named keys that send a single control character.
+var plainKeys = map[string]byte{
+	"Enter": '\r', "Tab": '\t', "Escape": 0x1b, "Backspace": 0x7f, "Space": ' ',
+}
+
+// keyAliases maps alternate spellings to the canonical names above.
+var keyAliases = map[string]string{
+	"Return": "Enter", "Esc": "Escape", "BSpace": "Backspace", "DC": "Delete",
+	"IC": "Insert", "PgUp": "PageUp", "PPage": "PageUp", "PgDn": "PageDown", "NPage": "PageDown",
+}
+
+// encodeKey turns one key name into the bytes a terminal would send.
+// appCursor is whether the application has DECCKM on.
+func encodeKey(name string, appCursor bool) ([]byte, error) {
+	var mods keyModifiers
+	key := name
+	// A single character after the prefixes is the key itself, so "C--"
+	// is Ctrl+minus rather than a bad modifier.
+	for len(key) > 2 && key[1] == '-' {
+		switch key[0] {
+		case 'C':
+			mods.ctrl = true
+		case 'M':
+			mods.meta = true
+		case 'S':
+			mods.shift = true
+		default:
+			return nil, fmt.Errorf("unknown modifier in key %q", name)
+		}
+		key = key[2:]
+	}
+	if alias, ok := keyAliases[key]; ok {
+		key = alias
+	}
+
+	modified := mods != keyModifiers{}
+	switch {
+	case key == "BTab":
+		return []byte("\x1b[Z"), nil
+	case cursorKeys[key] != 0:
+		final := cursorKeys[key]
+		if modified {
+			return []byte(fmt.Sprintf("\x1b[1;%d%c", mods.xtermParam(), final)), nil
+		}
+		if appCursor {
+			return []byte{0x1b, 'O', final}, nil
+		}
+		return []byte{0x1b, '[', final}, nil
+	case ss3Keys[key] != 0:
+		if modified {
+			return []byte(fmt.Sprintf("\x1b[1;%d%c", mods.xtermParam(), ss3Keys[key])), nil
+		}
+		return []byte{0x1b, 'O', ss3Keys[key]}, nil
+	case tildeKeys[key] != 0:
+		if modified {
+			return []byte(fmt.Sprintf("\x1b[%d;%d~", tildeKeys[key], mods.xtermParam())), nil
+		}
+		return []byte(fmt.Sprintf("\x1b[%d~", tildeKeys[key])), nil
+	}
+
+	var out []byte
+	if b, ok := plainKeys[key]; ok {
+		switch {
+		case key == "Tab" && mods.shift:
+			return []byte("\x1b[Z"), nil
+		case key == "Space" && mods.ctrl:
+			out = []byte{0}
+		default:
+			out = []byte{b}
+		}
+	} else {
+		r, size := utf8.DecodeRuneInString(key)
+		if size != len(key) || r == utf8.RuneError {
+			return nil, fmt.Errorf("unknown key %q", name)
+		}
+		if mods.shift {
+			key = strings.ToUpper(key)
+		}
+		out = []byte(key)
+		if mods.ctrl {
+			c, err := ctrlChar(r)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			out = []byte{c}
+		}
+	}
+	if mods.meta {
+		out = append([]byte{0x1b}, out...)
+	}
+	return out, nil
+}
+
+// ctrlChar is the control character Ctrl+r sends: C-a is 0x01, C-[ is
+// ESC, C-? is DEL.
+func ctrlChar(r rune) (byte, error) {
+	switch {
+	case r >= 'a' && r <= 'z':
+		return byte(r - 'a' + 1), nil
+	case r >= '@' && r <= '_':
+		return byte(r - '@'), nil
+	case r == '?':
+		return 0x7f, nil
+	case r == ' ' || r == '2':
+		return 0, nil
+	}
+	return 0, fmt.Errorf("no control character for %q", r)
+}
+
+// encodeKeys encodes a sequence of key names.
+func encodeKeys(names []string, appCursor bool) ([]byte, error) {
+	var out []byte
+	for _, name := range names {
+		b, err := encodeKey(name, appCursor)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b...)
+	}
+	return out, nil
+}
+
+// Bracketed paste markers (DECSET 2004).
+const (
+	pasteStart = "\x1b[200~"
+	pasteEnd   = "\x1b[201~"
+)
+
+// encodePaste prepares text for pasting. With bracketed paste it is
+// wrapped in the markers, minus any end marker inside it so the text can't
+// break out of the paste and be run as typed input. Without, newlines
+// become carriage returns, as a terminal sends them.
+func encodePaste(text string, bracketed bool) []byte {
+	if bracketed {
+		// Removing one marker can join the text around it into another.
+		for strings.Contains(text, pasteEnd) {
+			text = strings.ReplaceAll(text, pasteEnd, "")
+		}
+		return []byte(pasteStart + text + pasteEnd)
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\r")
+	return []byte(strings.ReplaceAll(text, "\n", "\r"))
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncodeKey(t *testing.T) {
+	cases := []struct {
+		name      string
+		appCursor bool
+		want      string
+	}{
+		{"a", false, "a"},
+		{"C-c", false, "\x03"},
+		{"C-[", false, "\x1b"},
+		{"C-Space", false, "\x00"},
+		{"M-x", false, "\x1bx"},
+		{"C-M-a", false, "\x1b\x01"},
+		{"S-a", false, "A"},
+		{"Enter", false, "\r"},
+		{"Return", false, "\r"},
+		{"Up", false, "\x1b[A"},
+		{"Up", true, "\x1bOA"},
+		{"C-Left", true, "\x1b[1;5D"},
+		{"S-Up", false, "\x1b[1;2A"},
+		{"F1", false, "\x1bOP"},
+		{"C-F1", false, "\x1b[1;5P"},
+		{"F5", false, "\x1b[15~"},
+		{"F12", false, "\x1b[24~"},
+		{"PageDown", false, "\x1b[6~"},
+		{"C-Delete", false, "\x1b[3;5~"},
+		{"BTab", false, "\x1b[Z"},
+		{"S-Tab", false, "\x1b[Z"},
+		{"é", false, "é"},
+	}
+	for _, c := range cases {
+		got, err := encodeKey(c.name, c.appCursor)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if string(got) != c.want {
+			t.Errorf("%s (appCursor=%v): expected %q, got %q", c.name, c.appCursor, c.want, got)
+		}
+	}
+	for _, bad := range []string{"Upp", "X-a", "C-é", "C--", ""} {
+		if _, err := encodeKey(bad, false); err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+}
+
+func TestEncodePaste(t *testing.T) {
+	if got := string(encodePaste("a\nb\r\nc", false)); got != "a\rb\rc" {
+		t.Fatalf("plain paste: got %q", got)
+	}
+	got := string(encodePaste("ls\n", true))
+	if got != pasteStart+"ls\n"+pasteEnd {
+		t.Fatalf("bracketed paste: got %q", got)
+	}
+	// Text must not be able to end the paste early, even by nesting markers.
+	evil := "x\x1b[20" + pasteEnd + "1~rm -rf ~\n"
+	got = string(encodePaste(evil, true))
+	if strings.Count(got, pasteEnd) != 1 || !strings.HasSuffix(got, pasteEnd) {
+		t.Fatalf("paste end marker leaked through: %q", got)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Limits on what clients may attach to a session. Everything here is kept
+// in memory and journaled, so it has to stay small.
+const (
+	maxNameLen      = 256
+	maxLabelKeyLen  = 63
+	maxLabelValLen  = 256
+	maxMetadataSize = 64 * 1024
+)
+
+// labelSelector is a parsed label query: comma-separated requirements that
+// must all hold, each "key=value", "key!=value", "key" (present) or
+// "!key" (absent).
+type labelSelector []labelRequirement
+
+type labelRequirement struct {
+	key   string
+	value string
+	op    string // "=", "!=", "exists", "!exists"
+}
+
+// parseSelector parses a selector. The empty string matches everything.
+func parseSelector(s string) (labelSelector, error) {
+	var sel labelSelector
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		var r labelRequirement
+		switch {
+		case strings.Contains(part, "!="):
+			k, v, _ := strings.Cut(part, "!=")
+			r = labelRequirement{key: strings.TrimSpace(k), value: strings.TrimSpace(v), op: "!="}
+		case strings.Contains(part, "="):
+			k, v, _ := strings.Cut(part, "=")
+			v = strings.TrimPrefix(v, "=") // accept "==" too
+			r = labelRequirement{key: strings.TrimSpace(k), value: strings.TrimSpace(v), op: "="}
+		case strings.HasPrefix(part, "!"):
+			r = labelRequirement{key: strings.TrimSpace(part[1:]), op: "!exists"}
+		default:
+			r = labelRequirement{key: part, op: "exists"}
+		}
+		if r.key == "" {
+			return nil, fmt.Errorf("invalid selector %q: missing key", part)
+		}
+		sel = append(sel, r)
+	}
+	return sel, nil
+}
+
+// matches reports whether labels satisfy every requirement.
+func (sel labelSelector) matches(labels map[string]string) bool {
+	for _, r := range sel {
+		v, ok := labels[r.key]
+		switch r.op {
+		case "=":
+			if !ok || v != r.value {
+				return false
+			}
+		case "!=":
+			if ok && v == r.value {
+				return false
+			}
+		case "exists":
+			if !ok {
+				return false
+			}
+		case "!exists":
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// validateLabels checks label keys and values are usable in selectors.
+func validateLabels(labels map[string]string) error {
+	for k, v := range labels {
+		if k == "" || len(k) > maxLabelKeyLen || strings.ContainsAny(k, "=!, ") {
+			return fmt.Errorf("invalid label key %q", k)
+		}
+		if len(v) > maxLabelValLen || strings.Contains(v, ",") {
+			return fmt.Errorf("invalid value for label %q", k)
+		}
+	}
+	return nil
+}
+
+// validateMetadata bounds the total size of a metadata map.
+func validateMetadata(meta map[string]string) error {
+	size := 0
+	for k, v := range meta {
+		size += len(k) + len(v)
+	}
+	if size > maxMetadataSize {
+		return fmt.Errorf("metadata too large: %d bytes (max %d)", size, maxMetadataSize)
+	}
+	return nil
+}
+
+// validateName bounds a display name.
+func validateName(name string) error {
+	if len(name) > maxNameLen {
+		return fmt.Errorf("name too long: %d bytes (max %d)", len(name), maxNameLen)
+	}
+	return nil
+}
+
+// mergeMap applies a patch to m: keys with a nil value are deleted, the
+// rest are set. It returns a new map and leaves m untouched, so readers
+// holding the old one are unaffected. An empty result is nil.
+func mergeMap(m map[string]string, patch map[string]*string) map[string]string {
+	out := make(map[string]string, len(m)+len(patch))
+	for k, v := range m {
+		out[k] = v
+	}
+	for k, v := range patch {
+		if v == nil {
+			delete(out, k)
+		} else {
+			out[k] = *v
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLabelSelector(t *testing.T) {
+	labels := map[string]string{"project": "web", "env": "dev"}
+	cases := []struct {
+		sel  string
+		want bool
+	}{
+		{"", true},
+		{"project=web", true},
+		{"project==web", true},
+		{"project=api", false},
+		{"project!=api", true},
+		{"env, project=web", true},
+		{"pinned", false},
+		{"!pinned", true},
+		{"!env", false},
+		{"missing!=x", true},
+	}
+	for _, c := range cases {
+		sel, err := parseSelector(c.sel)
+		if err != nil {
+			t.Fatalf("%q: %v", c.sel, err)
+		}
+		if got := sel.matches(labels); got != c.want {
+			t.Errorf("%q: expected %v, got %v", c.sel, c.want, got)
+		}
+	}
+	if _, err := parseSelector("=web"); err == nil {
+		t.Fatal("expected error for missing key")
+	}
+}
+
+func TestMergeMap(t *testing.T) {
+	v := "2"
+	orig := map[string]string{"a": "1", "b": "1"}
+	got := mergeMap(orig, map[string]*string{"a": nil, "c": &v})
+	if len(got) != 2 || got["b"] != "1" || got["c"] != "2" {
+		t.Fatalf("unexpected merge: %v", got)
+	}
+	if orig["a"] != "1" {
+		t.Fatal("merge must not modify the original map")
+	}
+	if mergeMap(map[string]string{"a": "1"}, map[string]*string{"a": nil}) != nil {
+		t.Fatal("emptied map should be nil")
+	}
+}
+
+func TestValidateLabels(t *testing.T) {
+	if err := validateLabels(map[string]string{"a=b": "x"}); err == nil {
+		t.Fatal("expected error for key containing '='")
+	}
+	if err := validateLabels(map[string]string{"k": "x,y"}); err == nil {
+		t.Fatal("expected error for value containing ','")
+	}
+	if err := validateMetadata(map[string]string{"k": strings.Repeat("x", maxMetadataSize)}); err == nil {
+		t.Fatal("expected error for oversized metadata")
+	}
+}
+
+func TestUpdate_PatchesAndJournals(t *testing.T) {
+	j, err := openJournal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm := newTestManager()
+	sm.UseJournal(j)
+	startTestSession(t, sm, "u1", "sleep 5", func(req *CreateRequest) {
+		req.Name = "build"
+		req.Labels = map[string]string{"project": "web", "tmp": "1"}
+		req.Metadata = map[string]string{"color": "blue"}
+	})
+
+	name, api := "api build", "api"
+	ev, err := sm.Update(UpdateRequest{
+		ID:     "u1",
+		Name:   &name,
+		Labels: map[string]*string{"project": &api, "tmp": nil},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Name != name || len(ev.Labels) != 1 || ev.Labels["project"] != "api" || ev.Metadata["color"] != "blue" {
+		t.Fatalf("unexpected update result: %+v", ev)
+	}
+	e, err := j.load("u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Request.Name != name || e.Request.Labels["project"] != "api" || e.Request.Metadata["color"] != "blue" {
+		t.Fatalf("journal not updated: %+v", e.Request)
+	}
+
+	bad := "x=y"
+	if _, err := sm.Update(UpdateRequest{ID: "u1", Labels: map[string]*string{bad: &api}}); err == nil {
+		t.Fatal("expected error for invalid label key")
+	}
+	if info := sm.List()[0]; info.Labels["project"] != "api" {
+		t.Fatalf("failed update must not change labels: %v", info.Labels)
+	}
+}
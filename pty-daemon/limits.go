@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// Enforcement modes reported for a session's resource limits.
+const (
+	enforceCgroup = "cgroup" // own cgroup v2 subtree: limits and accounting
+	enforceRlimit = "rlimit" // ulimit before exec: memory and processes only
+	enforceNone   = "none"   // limits requested but nothing could apply them
+)
+
+// cgroupManager owns the delegated cgroup v2 subtree sessions are placed
+// in. A nil manager means cgroups are unavailable.
+type cgroupManager struct {
+	base string // directory whose children are the daemon and session cgroups
+}
+
+// cgroupName turns a session ID into a safe cgroup directory name.
+func cgroupName(sessionID string) string {
+	var b strings.Builder
+	b.WriteString("session-")
+	for _, r := range sessionID {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// fallbackLimits works out the rlimits that stand in for a cgroup's
+// limits, as ulimit commands, and the resulting enforcement mode. They
+// are weaker than a cgroup's:
+//
+//   - Memory becomes RLIMIT_DATA, which caps each process's heap and
+//     private mappings rather than the tree's total. (RLIMIT_AS would
+//     count the address space V8 and Go reserve by the gigabyte.)
+//   - Pids becomes RLIMIT_NPROC, which counts every process of our uid,
+//     so it is set to what the uid already runs plus Pids.
+//   - CPUs has no rlimit equivalent and stays unenforced.
+//
+// Neither is raised past the daemon's own hard limit, which the session
+// would inherit anyway.
+func fallbackLimits(sessionID string, lim *SessionLimits) (ulimits []string, enforcement string) {
+	if lim == nil {
+		return nil, ""
+	}
+	var unenforced []string
+	if lim.MemoryBytes > 0 {
+		kib := capRlimit(syscall.RLIMIT_DATA, uint64(lim.MemoryBytes)) / 1024
+		ulimits = append(ulimits, fmt.Sprintf("ulimit -d %d", max(kib, 1)))
+	}
+	if lim.Pids > 0 {
+		if running, err := userTasks(os.Getuid()); err != nil {
+			slog.Warn("session.rlimit_failed", "session", sessionID, "limit", "pids", "err", err)
+			unenforced = append(unenforced, "pids")
+		} else {
+			// bash and zsh call it -u, dash -p (bash's -p is the pipe
+			// size, which can't be set, so it fails rather than misfires).
+			n := capRlimit(rlimitNproc, uint64(running+lim.Pids))
+			ulimits = append(ulimits, fmt.Sprintf("{ ulimit -u %d 2>/dev/null || ulimit -p %d; }", n, n))
+		}
+	}
+	if lim.CPUs > 0 {
+		unenforced = append(unenforced, "cpu")
+	}
+	if len(unenforced) > 0 {
+		slog.Warn("session.limits_unenforced", "session", sessionID,
+			"limits", strings.Join(unenforced, ","), "reason", "no cgroup")
+	}
+	if len(ulimits) == 0 {
+		return nil, enforceNone
+	}
+	return ulimits, enforceRlimit
+}
+
+// capRlimit lowers value to the daemon's hard limit for resource, if it
+// has one below it.
+func capRlimit(resource int, value uint64) uint64 {
+	var cur syscall.Rlimit
+	if err := syscall.Getrlimit(resource, &cur); err == nil && cur.Max < value {
+		return cur.Max
+	}
+	return value
+}
+
+// withUlimits makes cmd run through sh, which sets the limits on itself
+// and then execs the real command, so they are in place before the
+// command runs a single instruction. Setting them on the child with
+// prlimit after it starts would race with the first children it forks.
+func withUlimits(cmd *exec.Cmd, ulimits []string) {
+	script := strings.Join(ulimits, " && ") + ` && exec "$0" "$@"`
+	cmd.Args = append([]string{"sh", "-c", script, cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = "/bin/sh"
+}
+
+// treeStats sums CPU, RSS and process count over a session's process tree.
+// It is the accounting fallback for sessions without a cgroup.
+func treeStats(procs []procStat, root int) (cpuMs int64, rss int64, n int) {
+	for _, p := range descendants(procs, root) {
+		cpuMs += p.CPU.Milliseconds()
+		rss += p.RSSBytes
+		n++
+	}
+	return cpuMs, rss, n
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+// setupCgroups prepares a cgroup v2 subtree for sessions. cgroup v2 only
+// lets a cgroup hand controllers to its children when it has no processes
+// of its own, so the daemon moves itself into a "daemon" leaf and enables
+// the controllers on its original cgroup. That only succeeds when the
+// cgroup was delegated to us and nothing else lives in it (e.g. a systemd
+// unit with Delegate=yes); otherwise the move is undone and nil returned.
+func setupCgroups() (*cgroupManager, error) {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return nil, errors.New("cgroup v2 is not mounted")
+	}
+	own, err := ownCgroup()
+	if err != nil {
+		return nil, err
+	}
+	base := filepath.Join(cgroupRoot, own)
+	if filepath.Base(base) == "daemon" {
+		base = filepath.Dir(base)
+	}
+
+	data, err := os.ReadFile(filepath.Join(base, "cgroup.controllers"))
+	if err != nil {
+		return nil, err
+	}
+	var enable []string
+	for _, c := range strings.Fields(string(data)) {
+		if c == "memory" || c == "cpu" || c == "pids" {
+			enable = append(enable, "+"+c)
+		}
+	}
+	if len(enable) == 0 {
+		return nil, fmt.Errorf("no memory/cpu/pids controllers delegated to %s", base)
+	}
+
+	leaf := filepath.Join(base, "daemon")
+	if err := os.Mkdir(leaf, 0755); err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+	pid := strconv.Itoa(os.Getpid())
+	if err := writeCgroupFile(leaf, "cgroup.procs", pid); err != nil {
+		os.Remove(leaf)
+		return nil, fmt.Errorf("moving daemon into %s: %w", leaf, err)
+	}
+	if err := writeCgroupFile(base, "cgroup.subtree_control", strings.Join(enable, " ")); err != nil {
+		writeCgroupFile(base, "cgroup.procs", pid)
+		os.Remove(leaf)
+		return nil, fmt.Errorf("enabling controllers on %s: %w", base, err)
+	}
+
+	// Session cgroups left behind by a previous daemon are empty by now
+	// unless something escaped; rmdir fails harmlessly on those.
+	if entries, err := os.ReadDir(base); err == nil {
+		for _, e := range entries {
+			if e.IsDir() && strings.HasPrefix(e.Name(), "session-") {
+				os.Remove(filepath.Join(base, e.Name()))
+			}
+		}
+	}
+	return &cgroupManager{base: base}, nil
+}
+
+// ownCgroup returns the daemon's cgroup v2 path from /proc/self/cgroup.
+func ownCgroup() (string, error) {
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if path, ok := strings.CutPrefix(sc.Text(), "0::"); ok {
+			return path, nil
+		}
+	}
+	return "", errors.New("no cgroup v2 entry in /proc/self/cgroup")
+}
+
+func writeCgroupFile(dir, name, value string) error {
+	return os.WriteFile(filepath.Join(dir, name), []byte(value), 0)
+}
+
+func readCgroupInt(dir, name string) int64 {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	return n
+}
+
+// create makes a cgroup for a session, applies its limits and returns the
+// directory plus an open handle for placing the child in it at clone time.
+func (m *cgroupManager) create(sessionID string, lim *SessionLimits) (string, *os.File, error) {
+	dir := filepath.Join(m.base, cgroupName(sessionID))
+	os.Remove(dir) // stale, from a previous session with the same ID
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return "", nil, err
+	}
+	if lim != nil {
+		var errs []error
+		if lim.MemoryBytes > 0 {
+			errs = append(errs, writeCgroupFile(dir, "memory.max", strconv.FormatInt(lim.MemoryBytes, 10)))
+		}
+		if lim.CPUs > 0 {
+			const period = 100000
+			quota := int64(lim.CPUs * period)
+			errs = append(errs, writeCgroupFile(dir, "cpu.max", fmt.Sprintf("%d %d", quota, period)))
+		}
+		if lim.Pids > 0 {
+			errs = append(errs, writeCgroupFile(dir, "pids.max", strconv.Itoa(lim.Pids)))
+		}
+		if err := errors.Join(errs...); err != nil {
+			os.Remove(dir)
+			return "", nil, fmt.Errorf("applying limits: %w", err)
+		}
+	}
+	fd, err := os.Open(dir)
+	if err != nil {
+		os.Remove(dir)
+		return "", nil, err
+	}
+	return dir, fd, nil
+}
+
+// remove deletes a session's cgroup. It fails while processes remain.
+func (m *cgroupManager) remove(dir string) error {
+	return os.Remove(dir)
+}
+
+// cgroupStats reads live accounting for a session's cgroup.
+func cgroupStats(dir string) (cpuMs int64, memory int64, procs int) {
+	if data, err := os.ReadFile(filepath.Join(dir, "cpu.stat")); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if v, ok := strings.CutPrefix(line, "usage_usec "); ok {
+				usec, _ := strconv.ParseInt(v, 10, 64)
+				cpuMs = usec / 1000
+			}
+		}
+	}
+	memory = readCgroupInt(dir, "memory.current")
+	procs = int(readCgroupInt(dir, "pids.current"))
+	return cpuMs, memory, procs
+}
+
+// placeInCgroup makes the child start inside the cgroup (clone3 with
+// CLONE_INTO_CGROUP), so it can't fork anything outside it first.
+func placeInCgroup(cmd *exec.Cmd, fd *os.File) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(fd.Fd())
+}
+
+// rlimitNproc is RLIMIT_NPROC on amd64 and arm64; syscall doesn't name it.
+const rlimitNproc = 6
+
+// userTasks counts the threads of a uid's processes, which is what
+// RLIMIT_NPROC is checked against.
+func userTasks(uid int) (int, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, e := range entries {
+		if _, err := strconv.Atoi(e.Name()); err != nil {
+			continue
+		}
+		fi, err := os.Stat(filepath.Join("/proc", e.Name()))
+		if err != nil {
+			continue // exited
+		}
+		if owner, ok := fileOwner(fi); !ok || owner != uint32(uid) {
+			continue
+		}
+		tasks, err := os.ReadDir(filepath.Join("/proc", e.Name(), "task"))
+		if err != nil {
+			continue
+		}
+		n += len(tasks)
+	}
+	return n, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// procLimit returns the soft limit column of a /proc/<pid>/limits row.
+func procLimit(t *testing.T, pid int, row string) string {
+	t.Helper()
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/limits", pid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if rest, ok := strings.CutPrefix(line, row); ok {
+			return strings.Fields(rest)[0]
+		}
+	}
+	t.Fatalf("no %q row in limits:\n%s", row, data)
+	return ""
+}
+
+func TestCreate_LimitsWithoutCgroupUseRlimits(t *testing.T) {
+	sm := newTestManager()
+	sess := startTestSession(t, sm, "rl1", "sleep 5", func(req *CreateRequest) {
+		req.Limits = &SessionLimits{MemoryBytes: 256 << 20, Pids: 50}
+	})
+	if sess.cgroupDir != "" {
+		t.Skip("cgroups are delegated here; the fallback isn't used")
+	}
+	if sess.enforcement != enforceRlimit {
+		t.Fatalf("expected enforcement %q, got %q", enforceRlimit, sess.enforcement)
+	}
+	// The limits are set by a shell that then execs the command.
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		argv, _ := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", sess.Pid))
+		if len(argv) > 0 && !strings.Contains(string(argv), "ulimit") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("session never exec'd its command, running %q", argv)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := procLimit(t, sess.Pid, "Max data size"); got != fmt.Sprint(256<<20) {
+		t.Fatalf("expected a data limit of %d, got %s", 256<<20, got)
+	}
+	running, err := userTasks(os.Getuid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	nproc := 0
+	fmt.Sscan(procLimit(t, sess.Pid, "Max processes"), &nproc)
+	// Other tests' processes come and go, so allow some slack.
+	if nproc < 50 || nproc > running+50+20 {
+		t.Fatalf("expected a process limit near %d, got %d", running+50, nproc)
+	}
+
+	stats, err := sm.Stats("rl1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[0].Enforcement != enforceRlimit {
+		t.Fatalf("expected stats to report %q, got %+v", enforceRlimit, stats)
+	}
+}
+
+func TestCreate_DataRlimitStopsAllocation(t *testing.T) {
+	codes := make(chan int, 1)
+	sm := NewSessionManager(func(string, string, uint64) {}, func(_ string, code int, _ int, _ ExitDetail) {
+		codes <- code
+	})
+	// awk doubles a string towards 1GB; under a 32MB data limit it fails
+	// long before that.
+	sess := startTestSession(t, sm, "rl2", `awk 'BEGIN { s = "x"; while (length(s) < 1073741824) s = s s; print "done" }'`, func(req *CreateRequest) {
+		req.Limits = &SessionLimits{MemoryBytes: 32 << 20}
+	})
+	if sess.cgroupDir != "" {
+		t.Skip("cgroups are delegated here; the fallback isn't used")
+	}
+	select {
+	case code := <-codes:
+		if code == 0 {
+			b, _, _ := sm.GetScrollback("rl2")
+			t.Fatalf("expected the allocation to fail under the data limit %q %s", b, sess.enforcement)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("session didn't exit")
+	}
+}
@@ -0,0 +1,32 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+var errNoCgroups = errors.New("cgroups are only available on Linux")
+
+func setupCgroups() (*cgroupManager, error) { return nil, errNoCgroups }
+
+func (m *cgroupManager) create(sessionID string, lim *SessionLimits) (string, *os.File, error) {
+	return "", nil, errNoCgroups
+}
+
+func (m *cgroupManager) remove(dir string) error { return errNoCgroups }
+
+func cgroupStats(dir string) (cpuMs int64, memory int64, procs int) { return 0, 0, 0 }
+
+func placeInCgroup(cmd *exec.Cmd, fd *os.File) {}
+
+// rlimitNproc is RLIMIT_NPROC as darwin numbers it.
+const rlimitNproc = 7
+
+// userTasks is unsupported: without /proc, a process limit can't be put
+// relative to what the uid already runs.
+func userTasks(uid int) (int, error) {
+	return 0, errors.New("cannot count a user's processes on this platform")
+}
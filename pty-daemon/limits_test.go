@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCgroupName(t *testing.T) {
+	if got := cgroupName("pty-1"); got != "session-pty-1" {
+		t.Fatalf("expected session-pty-1, got %s", got)
+	}
+	if got := cgroupName("../x y"); got != "session-.._x_y" {
+		t.Fatalf("expected path separators escaped, got %s", got)
+	}
+}
+
+func TestTreeStats(t *testing.T) {
+	procs := []procStat{
+		{Pid: 10, Ppid: 1, CPU: 1500 * time.Millisecond, RSSBytes: 100},
+		{Pid: 11, Ppid: 10, CPU: 500 * time.Millisecond, RSSBytes: 50},
+		{Pid: 20, Ppid: 1, CPU: time.Hour, RSSBytes: 1 << 30},
+	}
+	cpu, rss, n := treeStats(procs, 10)
+	if cpu != 2000 || rss != 150 || n != 2 {
+		t.Fatalf("expected 2000ms/150B/2, got %dms/%dB/%d", cpu, rss, n)
+	}
+}
+
+func TestStats_TreeFallback(t *testing.T) {
+	sm := newTestManager()
+	startTestSession(t, sm, "st1", "sleep 5")
+	time.Sleep(100 * time.Millisecond)
+
+	stats, err := sm.Stats("st1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[0].Source != "tree" || stats[0].Processes < 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if stats[0].MemoryBytes <= 0 {
+		t.Fatalf("expected non-zero RSS, got %d", stats[0].MemoryBytes)
+	}
+}
+
+func TestCreate_CPULimitWithoutCgroupIsUnenforced(t *testing.T) {
+	sm := newTestManager()
+	sess := startTestSession(t, sm, "lim1", "sleep 5", func(req *CreateRequest) {
+		req.Limits = &SessionLimits{CPUs: 0.5}
+	})
+	if sess.enforcement != enforceNone {
+		t.Fatalf("expected enforcement %q without a cgroup, got %q", enforceNone, sess.enforcement)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const lockName = "pty-daemon.lock"
+
+func lockPath() string { return filepath.Join(socketDir(), lockName) }
+
+// errLocked means another daemon holds the single-instance lock.
+var errLocked = errors.New("another daemon holds the lock")
+
+// acquireLock takes the exclusive single-instance lock and records our pid
+// in the lock file. The kernel drops the lock when the process exits, so
+// unlike the pid file it can't go stale; the returned file must stay open
+// for the daemon's lifetime.
+func acquireLock() (*os.File, error) {
+	f, err := os.OpenFile(lockPath(), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, errLocked
+		}
+		return nil, err
+	}
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+	}
+	return f, nil
+}
+
+// lockHolder reports whether a daemon currently holds the lock, and the pid
+// it recorded. The pid is only meaningful while the lock is held, which is
+// what makes it safe against pid reuse.
+func lockHolder() (bool, int) {
+	f, err := os.Open(lockPath())
+	if err != nil {
+		return false, 0
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_SH|syscall.LOCK_NB); err == nil {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		return false, 0
+	}
+	data := make([]byte, 32)
+	n, _ := f.ReadAt(data, 0)
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data[:n])))
+	return true, pid
+}
+
+// removePidFile deletes the pid file if it still names this process, so a
+// daemon exiting late can't remove a successor's.
+func removePidFile() {
+	if readPid() == os.Getpid() {
+		os.Remove(pidPath())
+	}
+}
+
+// probeDaemon asks whatever is listening on the socket who it is. An error
+// means nothing answered, however the socket file looks. Any well-formed
+// reply means a daemon is there: one from before the version request
+// answers with an error, and is reported with version "unknown" and the
+// pid from its pid file, since it holds no lock either.
+func probeDaemon() (*VersionResponse, error) {
+	var resp VersionResponse
+	err := request(VersionRequest{Type: "version"}, &resp)
+	var legacy replyError
+	switch {
+	case errors.As(err, &legacy):
+		return &VersionResponse{Type: "version", Version: "unknown", Pid: readPid()}, nil
+	case err != nil:
+		return nil, err
+	}
+	if resp.Type != "version" {
+		return nil, fmt.Errorf("unexpected reply %q", resp.Type)
+	}
+	return &resp, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestAcquireLock_SingleInstance(t *testing.T) {
+	t.Setenv("SPACETERM_HOME", t.TempDir())
+
+	if held, _ := lockHolder(); held {
+		t.Fatal("no lock file should mean not held")
+	}
+	lock, err := acquireLock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// flock locks belong to the open file description, so a second open in
+	// the same process conflicts just like another daemon would.
+	if _, err := acquireLock(); err != errLocked {
+		t.Fatalf("expected errLocked, got %v", err)
+	}
+	held, pid := lockHolder()
+	if !held || pid != os.Getpid() {
+		t.Fatalf("expected held by %d, got held=%v pid=%d", os.Getpid(), held, pid)
+	}
+
+	lock.Close()
+	if held, _ := lockHolder(); held {
+		t.Fatal("lock should be free after close")
+	}
+	again, err := acquireLock()
+	if err != nil {
+		t.Fatalf("reacquire after release: %v", err)
+	}
+	again.Close()
+}
+
+func TestRemovePidFile_OnlyOwn(t *testing.T) {
+	t.Setenv("SPACETERM_HOME", t.TempDir())
+
+	os.WriteFile(pidPath(), []byte("1"), 0644)
+	removePidFile()
+	if _, err := os.Stat(pidPath()); err != nil {
+		t.Fatal("another process's pid file should be kept")
+	}
+	os.WriteFile(pidPath(), []byte(strconv.Itoa(os.Getpid())), 0644)
+	removePidFile()
+	if _, err := os.Stat(pidPath()); !os.IsNotExist(err) {
+		t.Fatal("own pid file should be removed")
+	}
+}
+
+func TestProbeDaemon_LegacyDaemon(t *testing.T) {
+	t.Setenv("SPACETERM_HOME", t.TempDir())
+	if _, err := probeDaemon(); err == nil {
+		t.Fatal("expected no daemon without a socket")
+	}
+
+	// A daemon from before the version request: it answers with an error
+	// and is only known by its pid file.
+	ln, err := net.Listen("unix", socketPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			bufio.NewReader(conn).ReadBytes('\n')
+			conn.Write([]byte(`{"type":"error","message":"unknown type: version"}` + "\n"))
+			conn.Close()
+		}
+	}()
+	os.WriteFile(pidPath(), []byte(strconv.Itoa(os.Getpid())), 0644)
+
+	v, err := probeDaemon()
+	if err != nil {
+		t.Fatalf("expected a legacy daemon to count as running, got %v", err)
+	}
+	if v.Version != "unknown" || v.Pid != os.Getpid() || runningPid() != os.Getpid() {
+		t.Fatalf("expected version unknown and pid %d, got %+v", os.Getpid(), v)
+	}
+}
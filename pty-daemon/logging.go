@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Default log rotation: the live file rolls over to .1 past logMaxBytes,
+// and logKeep rolled files are retained. Both are configurable.
+const (
+	logMaxBytes = 10 * 1024 * 1024
+	logKeep     = 3
+)
+
+// logLevelEnv overrides the configured level.
+const logLevelEnv = "SPACETERM_PTY_LOG_LEVEL"
+
+// logLevel is shared by the handler so the level can change at runtime.
+var logLevel = new(slog.LevelVar)
+
+// parseLogLevel accepts debug, info, warn or error.
+func parseLogLevel(s string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("unknown log level: %s", s)
+	}
+	return l, nil
+}
+
+// logWriter is the daemon's log file, kept so a reload can resize rotation.
+var logWriter *rotatingWriter
+
+// setupLogging sends slog (and the standard log package, via slog's
+// default bridge) to a rotating JSON-lines file. Each line's "event" is a
+// dotted event name; "session" and "client" carry IDs where relevant.
+func setupLogging(path string, cfg *Config) error {
+	level, err := parseLogLevel(cfg.LogLevel)
+	if err != nil {
+		return err
+	}
+	w, err := newRotatingWriter(path, cfg.LogMaxBytes, cfg.LogKeep)
+	if err != nil {
+		return err
+	}
+	logWriter = w
+	logLevel.Set(level)
+	h := slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level: logLevel,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.MessageKey {
+				a.Key = "event"
+			}
+			return a
+		},
+	})
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// fatal logs an error event and exits.
+func fatal(event string, args ...any) {
+	slog.Error(event, args...)
+	os.Exit(1)
+}
+
+// rotatingWriter is an append-only file that rolls over by size:
+// path → path.1 → path.2 … up to keep files.
+type rotatingWriter struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	keep     int
+	f        *os.File
+	size     int64
+}
+
+func newRotatingWriter(path string, maxBytes int64, keep int) (*rotatingWriter, error) {
+	w := &rotatingWriter{path: path, maxBytes: maxBytes, keep: keep}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// SetLimits changes the rotation size and retention from the next write.
+func (w *rotatingWriter) SetLimits(maxBytes int64, keep int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.maxBytes, w.keep = maxBytes, keep
+}
+
+func (w *rotatingWriter) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.f, w.size = f, fi.Size()
+	return nil
+}
+
+// Write appends p, rotating first if it would push the file past maxBytes.
+// A single oversized write still goes in whole: lines are never split.
+func (w *rotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.size > 0 && w.size+int64(len(p)) > w.maxBytes {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *rotatingWriter) rotate() error {
+	w.f.Close()
+	os.Remove(rotatedLogPath(w.path, w.keep))
+	for i := w.keep - 1; i >= 1; i-- {
+		os.Rename(rotatedLogPath(w.path, i), rotatedLogPath(w.path, i+1))
+	}
+	if w.keep > 0 {
+		os.Rename(w.path, rotatedLogPath(w.path, 1))
+	} else {
+		os.Remove(w.path)
+	}
+	return w.open()
+}
+
+func rotatedLogPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// logFilter selects log lines for `pty-daemon logs`.
+type logFilter struct {
+	session string
+	client  string
+	level   slog.Level
+}
+
+// formatLogLine renders one JSON log line for humans, or returns ok=false
+// if the filter rejects it. Lines that aren't JSON (written before the
+// switch to structured logging) pass through only when no filter is set.
+func formatLogLine(line []byte, f logFilter) (string, bool) {
+	var rec map[string]any
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return string(line), f.session == "" && f.client == "" && f.level <= slog.LevelInfo
+	}
+	if f.session != "" && rec["session"] != f.session {
+		return "", false
+	}
+	if f.client != "" && rec["client"] != f.client {
+		return "", false
+	}
+	levelStr, _ := rec["level"].(string)
+	if l, err := parseLogLevel(levelStr); err == nil && l < f.level {
+		return "", false
+	}
+
+	var b strings.Builder
+	ts, _ := rec["time"].(string)
+	if len(ts) >= 23 {
+		ts = strings.Replace(ts[:23], "T", " ", 1) // to the millisecond
+	}
+	fmt.Fprintf(&b, "%s %-5s %v", ts, levelStr, rec["event"])
+	keys := make([]string, 0, len(rec))
+	for k := range rec {
+		if k != "time" && k != "level" && k != "event" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%v", k, rec[k])
+	}
+	return b.String(), true
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotatingWriter_RotatesAndRetains(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "d.log")
+	w, err := newRotatingWriter(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"aaaaaaaa\n", "bbbbbbbb\n", "cccccccc\n", "dddddddd\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(p string) string {
+		data, _ := os.ReadFile(p)
+		return string(data)
+	}
+	if got := read(path); got != "dddddddd\n" {
+		t.Fatalf("live file: expected newest line, got %q", got)
+	}
+	if got := read(path + ".1"); got != "cccccccc\n" {
+		t.Fatalf(".1: got %q", got)
+	}
+	if got := read(path + ".2"); got != "bbbbbbbb\n" {
+		t.Fatalf(".2: got %q", got)
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatal("expected only 2 rotated files to be kept")
+	}
+}
+
+func TestFormatLogLine_Filters(t *testing.T) {
+	line := []byte(`{"time":"2026-10-18T12:00:00.123456+00:00","level":"INFO","event":"session.created","session":"s1","client":"c2","pid":42}`)
+	out, ok := formatLogLine(line, logFilter{session: "s1", level: slog.LevelDebug})
+	if !ok {
+		t.Fatal("expected line to match session filter")
+	}
+	if !strings.HasPrefix(out, "2026-10-18 12:00:00.123 INFO  session.created") || !strings.Contains(out, "pid=42") {
+		t.Fatalf("unexpected format: %q", out)
+	}
+	if _, ok := formatLogLine(line, logFilter{session: "s2"}); ok {
+		t.Fatal("expected other session to be filtered out")
+	}
+	if _, ok := formatLogLine(line, logFilter{level: slog.LevelWarn}); ok {
+		t.Fatal("expected info line to be below warn")
+	}
+	if _, ok := formatLogLine([]byte("2026/01/01 old plain line"), logFilter{session: "s1"}); ok {
+		t.Fatal("plain lines can't match a session filter")
+	}
+}
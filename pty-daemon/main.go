@@ -16,6 +16,9 @@ const (
 	logName    = "pty-daemon.log"
 )
 
+// version is stamped at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
 func socketDir() string {
 	if d := os.Getenv("SPACETERM_HOME"); d != "" {
 		return d
@@ -24,16 +27,37 @@ func socketDir() string {
 	return filepath.Join(home, ".spaceterm")
 }
 
-func socketPath() string { return filepath.Join(socketDir(), socketName) }
-func pidPath() string    { return filepath.Join(socketDir(), pidName) }
-func logPath() string    { return filepath.Join(socketDir(), logName) }
+func socketPath() string {
+	if p := currentConfig().SocketPath; p != "" {
+		return p
+	}
+	return filepath.Join(socketDir(), socketName)
+}
+
+func pidPath() string { return filepath.Join(socketDir(), pidName) }
+func logPath() string { return filepath.Join(socketDir(), logName) }
 
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "Usage: pty-daemon <start|stop|restart|run|status>\n")
+		fmt.Fprintf(os.Stderr, "Usage: pty-daemon <start|stop|restart|run|status|list|update|keys|paste|pause|resume|output|export|write-many|group|ps|stats|logs|resurrect|config|install-unit>\n")
 		os.Exit(1)
 	}
 
+	// Every command needs the config for the socket path. The daemon
+	// refuses to run on a bad config; other commands warn and use defaults.
+	if os.Args[1] != "config" {
+		cfg, err := loadConfig(configPath())
+		if err != nil {
+			if os.Args[1] == "run" {
+				fmt.Fprintf(os.Stderr, "Invalid config: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Fprintf(os.Stderr, "Warning: ignoring invalid config: %v\n", err)
+		} else {
+			config.Store(&cfg)
+		}
+	}
+
 	switch os.Args[1] {
 	case "start":
 		cmdStart()
@@ -46,6 +70,36 @@ func main() {
 		runDaemon()
 	case "status":
 		cmdStatus()
+	case "list":
+		cmdList(os.Args[2:])
+	case "update":
+		cmdUpdate(os.Args[2:])
+	case "keys":
+		cmdKeys(os.Args[2:])
+	case "paste":
+		cmdPaste(os.Args[2:])
+	case "pause", "resume":
+		cmdFlow(os.Args[1], os.Args[2:])
+	case "output":
+		cmdOutput(os.Args[2:])
+	case "export":
+		cmdExport(os.Args[2:])
+	case "write-many":
+		cmdWriteMany(os.Args[2:])
+	case "group":
+		cmdGroup(os.Args[2:])
+	case "ps":
+		cmdPs(os.Args[2:])
+	case "stats":
+		cmdStats(os.Args[2:])
+	case "logs":
+		cmdLogs(os.Args[2:])
+	case "resurrect":
+		cmdResurrect(os.Args[2:])
+	case "config":
+		cmdConfig(os.Args[2:])
+	case "install-unit":
+		cmdInstallUnit(os.Args[2:])
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", os.Args[1])
 		os.Exit(1)
@@ -53,16 +107,15 @@ func main() {
 }
 
 func cmdStart() {
-	if pid := readPid(); pid != 0 {
-		if processAlive(pid) {
-			fmt.Printf("Daemon already running (pid %d)\n", pid)
-			return
-		}
-		// Stale PID file — clean up.
-		os.Remove(pidPath())
+	if v, err := probeDaemon(); err == nil {
+		fmt.Printf("Daemon already running (pid %d, version %s)\n", v.Pid, v.Version)
+		return
 	}
-	// Clean stale socket.
-	os.Remove(socketPath())
+	if held, pid := lockHolder(); held {
+		fmt.Fprintf(os.Stderr, "Daemon holds the lock (pid %d) but is not answering on %s\n", pid, socketPath())
+		os.Exit(1)
+	}
+	// Anything left on disk is stale; the daemon cleans it up itself.
 
 	// Re-exec self with "run" subcommand, detached from terminal.
 	exePath, err := os.Executable()
@@ -80,34 +133,63 @@ func cmdStart() {
 		fmt.Fprintf(os.Stderr, "Failed to start daemon: %v\n", err)
 		os.Exit(1)
 	}
-	// Release the child so we don't become a zombie parent.
-	cmd.Process.Release()
+	// Reap the child if it exits early (e.g. it lost the lock race) so we
+	// can stop waiting; otherwise it outlives us.
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
 
-	// Wait for the socket to appear (up to 5 seconds).
+	// Wait for the daemon to answer (up to 5 seconds).
 	for i := 0; i < 50; i++ {
-		if _, err := os.Stat(socketPath()); err == nil {
-			pid := readPid()
-			fmt.Printf("Daemon started (pid %d)\n", pid)
+		if v, err := probeDaemon(); err == nil {
+			fmt.Printf("Daemon started (pid %d, version %s)\n", v.Pid, v.Version)
 			return
 		}
-		time.Sleep(100 * time.Millisecond)
+		select {
+		case err := <-exited:
+			if v, perr := probeDaemon(); perr == nil {
+				// Another start won the race; that daemon is the one running.
+				fmt.Printf("Daemon already running (pid %d, version %s)\n", v.Pid, v.Version)
+				return
+			}
+			fmt.Fprintf(os.Stderr, "Daemon exited during startup (%v); see %s\n", err, logPath())
+			os.Exit(1)
+		case <-time.After(100 * time.Millisecond):
+		}
 	}
-	fmt.Fprintf(os.Stderr, "Daemon started but socket not yet available\n")
+	fmt.Fprintf(os.Stderr, "Daemon started but not yet answering on %s\n", socketPath())
+}
+
+// runningPid finds the daemon's pid without trusting a possibly stale pid
+// file: from the daemon itself, or from the lock file while it is held. The
+// pid file is only used for a daemon old enough to hold no lock, and only
+// while it answers on the socket (see probeDaemon).
+func runningPid() int {
+	if v, err := probeDaemon(); err == nil {
+		return v.Pid
+	}
+	if held, pid := lockHolder(); held {
+		return pid
+	}
+	return 0
 }
 
 func cmdStop() {
-	pid := readPid()
-	if pid == 0 || !processAlive(pid) {
+	pid := runningPid()
+	if pid == 0 {
 		fmt.Println("Daemon not running")
-		os.Remove(pidPath())
-		os.Remove(socketPath())
 		return
 	}
+	// A daemon from before the lock has stopped once its process is gone;
+	// a current one once it has released the lock, just before exiting.
+	stopped := func() bool {
+		held, _ := lockHolder()
+		return !held && !processAlive(pid)
+	}
 	// Send SIGTERM for graceful shutdown.
 	syscall.Kill(pid, syscall.SIGTERM)
-	// Wait up to 5 seconds for the process to exit.
+	// Wait up to 5 seconds for it to go.
 	for i := 0; i < 50; i++ {
-		if !processAlive(pid) {
+		if stopped() {
 			fmt.Printf("Daemon stopped (was pid %d)\n", pid)
 			return
 		}
@@ -115,18 +197,36 @@ func cmdStop() {
 	}
 	fmt.Fprintf(os.Stderr, "Daemon did not stop within 5s, sending SIGKILL\n")
 	syscall.Kill(pid, syscall.SIGKILL)
-	time.Sleep(200 * time.Millisecond)
+	for i := 0; i < 20; i++ {
+		if stopped() {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
 	os.Remove(pidPath())
 	os.Remove(socketPath())
 }
 
+// cmdStatus exits 0 when the daemon answers, 2 when it holds the lock but
+// doesn't answer, and 1 when it isn't running.
 func cmdStatus() {
-	pid := readPid()
-	if pid == 0 || !processAlive(pid) {
-		fmt.Println("Daemon is not running")
-		os.Exit(1)
+	if v, err := probeDaemon(); err == nil {
+		if v.StartedAt == 0 {
+			// Too old to say more; restart it to upgrade.
+			fmt.Printf("Daemon is running (pid %d, version %s)\n", v.Pid, v.Version)
+			return
+		}
+		uptime := time.Since(time.UnixMilli(v.StartedAt)).Round(time.Second)
+		fmt.Printf("Daemon is running (pid %d, version %s, up %s, %d sessions)\n",
+			v.Pid, v.Version, uptime, v.Sessions)
+		return
+	}
+	if held, pid := lockHolder(); held {
+		fmt.Printf("Daemon is running (pid %d) but not answering on %s\n", pid, socketPath())
+		os.Exit(2)
 	}
-	fmt.Printf("Daemon is running (pid %d)\n", pid)
+	fmt.Println("Daemon is not running")
+	os.Exit(1)
 }
 
 func readPid() int {
@@ -0,0 +1,6 @@
+package main
+
+import "syscall"
+
+// maxRSSBytes converts ru_maxrss, which darwin reports in bytes.
+func maxRSSBytes(ru *syscall.Rusage) int64 { return int64(ru.Maxrss) }
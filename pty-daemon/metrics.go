@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// metricsAddrEnv names the loopback address to serve /metrics on, e.g.
+// "127.0.0.1:9464". Unset means no HTTP endpoint.
+const metricsAddrEnv = "SPACETERM_PTY_METRICS_ADDR"
+
+// latencyBuckets are the histogram upper bounds for broadcast latency.
+var latencyBuckets = []time.Duration{
+	100 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+// histogram is a fixed-bucket latency histogram, Prometheus-style.
+type histogram struct {
+	mu     sync.Mutex
+	counts []uint64 // counts[i] = observations ≤ latencyBuckets[i]; last is +Inf
+	sum    time.Duration
+	max    time.Duration
+	n      uint64
+}
+
+func newHistogram() *histogram {
+	return &histogram{counts: make([]uint64, len(latencyBuckets)+1)}
+}
+
+// Observe records one latency.
+func (h *histogram) Observe(d time.Duration) {
+	i := sort.Search(len(latencyBuckets), func(i int) bool { return d <= latencyBuckets[i] })
+	h.mu.Lock()
+	h.counts[i]++
+	h.sum += d
+	h.n++
+	if d > h.max {
+		h.max = d
+	}
+	h.mu.Unlock()
+}
+
+// Snapshot summarises the histogram. P99 is the upper bound of the bucket
+// holding the 99th percentile, so it overestimates by at most one bucket.
+func (h *histogram) Snapshot() LatencyStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	st := LatencyStats{Count: h.n, MaxUs: h.max.Microseconds()}
+	if h.n == 0 {
+		return st
+	}
+	st.AvgUs = (h.sum / time.Duration(h.n)).Microseconds()
+	target := uint64(math.Ceil(float64(h.n) * 0.99))
+	var cum uint64
+	for i, c := range h.counts {
+		cum += c
+		if cum >= target {
+			if i < len(latencyBuckets) {
+				st.P99Us = latencyBuckets[i].Microseconds()
+			} else {
+				st.P99Us = st.MaxUs
+			}
+			break
+		}
+	}
+	return st
+}
+
+// daemonMetrics holds the daemon-wide counters. Per-session byte counts
+// live on the Session, per-client counts on the Client.
+type daemonMetrics struct {
+	started         time.Time
+	broadcast       *histogram
+	outputBatches   atomic.Uint64
+	sessionsCreated atomic.Uint64
+	sessionsExited  atomic.Uint64
+	sweeps          atomic.Uint64
+	swept           atomic.Uint64
+	lastSweep       atomic.Int64 // unix ms
+}
+
+var metrics = &daemonMetrics{started: time.Now(), broadcast: newHistogram()}
+
+// daemonStats gathers the daemon-level half of a StatsResponse.
+func daemonStats(sm *SessionManager) *DaemonStats {
+	alive, dead, ringAlloc, ringUsed := sm.Totals()
+	st := &DaemonStats{
+		Pid:             os.Getpid(),
+		UptimeSec:       int64(time.Since(metrics.started).Seconds()),
+		Goroutines:      runtime.NumGoroutine(),
+		SessionsAlive:   alive,
+		SessionsDead:    dead,
+		SessionsCreated: metrics.sessionsCreated.Load(),
+		SessionsExited:  metrics.sessionsExited.Load(),
+		RingAllocated:   ringAlloc,
+		RingUsed:        ringUsed,
+		Broadcast:       metrics.broadcast.Snapshot(),
+		OutputBatches:   metrics.outputBatches.Load(),
+		Sweeps:          metrics.sweeps.Load(),
+		SweptSessions:   metrics.swept.Load(),
+		LastSweep:       metrics.lastSweep.Load(),
+	}
+	clientsMu.Lock()
+	for c := range clients {
+		cs := ClientStats{ID: c.id, Attached: len(c.attached), Sent: c.sent.Load()}
+		for id := range c.attached {
+			if controllers[id] == c {
+				cs.Controls++
+			}
+		}
+		cs.QueuedBytes, _ = socketQueued(c.conn)
+		st.Clients = append(st.Clients, cs)
+	}
+	clientsMu.Unlock()
+	sort.Slice(st.Clients, func(i, j int) bool { return st.Clients[i].ID < st.Clients[j].ID })
+	return st
+}
+
+// writePrometheus renders the metrics in the Prometheus text format.
+func writePrometheus(w io.Writer, sm *SessionManager) {
+	st := daemonStats(sm)
+	gauge := func(name, help string, v interface{}) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", name, help, name, name, v)
+	}
+	counter := func(name, help string, v uint64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, v)
+	}
+
+	fmt.Fprintf(w, "# HELP pty_daemon_sessions Sessions by state.\n# TYPE pty_daemon_sessions gauge\n")
+	fmt.Fprintf(w, "pty_daemon_sessions{state=\"alive\"} %d\n", st.SessionsAlive)
+	fmt.Fprintf(w, "pty_daemon_sessions{state=\"dead\"} %d\n", st.SessionsDead)
+	counter("pty_daemon_sessions_created_total", "Sessions created.", st.SessionsCreated)
+	counter("pty_daemon_sessions_exited_total", "Session processes that exited.", st.SessionsExited)
+	gauge("pty_daemon_clients", "Connected clients.", len(st.Clients))
+	gauge("pty_daemon_goroutines", "Live goroutines.", st.Goroutines)
+	gauge("pty_daemon_ring_allocated_bytes", "Memory allocated to ring buffers.", st.RingAllocated)
+	gauge("pty_daemon_ring_used_bytes", "Ring buffer bytes holding output.", st.RingUsed)
+	counter("pty_daemon_output_batches_total", "Batches of session output sent to clients.", st.OutputBatches)
+	counter("pty_daemon_sweeps_total", "Dead-session sweeps run.", st.Sweeps)
+	counter("pty_daemon_swept_sessions_total", "Dead sessions removed by the sweeper.", st.SweptSessions)
+
+	fmt.Fprintf(w, "# HELP pty_daemon_client_queued_bytes Bytes waiting in a client's socket send queue.\n")
+	fmt.Fprintf(w, "# TYPE pty_daemon_client_queued_bytes gauge\n")
+	for _, c := range st.Clients {
+		fmt.Fprintf(w, "pty_daemon_client_queued_bytes{client=%q} %d\n", c.ID, c.QueuedBytes)
+	}
+
+	fmt.Fprintf(w, "# HELP pty_daemon_session_output_bytes_total PTY output bytes per session.\n")
+	fmt.Fprintf(w, "# TYPE pty_daemon_session_output_bytes_total counter\n")
+	counts := sm.IOCounts()
+	for _, s := range counts {
+		fmt.Fprintf(w, "pty_daemon_session_output_bytes_total{session=%q} %d\n", s.ID, s.BytesOut)
+	}
+	fmt.Fprintf(w, "# HELP pty_daemon_session_input_bytes_total Input bytes written to each PTY.\n")
+	fmt.Fprintf(w, "# TYPE pty_daemon_session_input_bytes_total counter\n")
+	for _, s := range counts {
+		fmt.Fprintf(w, "pty_daemon_session_input_bytes_total{session=%q} %d\n", s.ID, s.BytesIn)
+	}
+
+	h := metrics.broadcast
+	h.mu.Lock()
+	fmt.Fprintf(w, "# HELP pty_daemon_broadcast_seconds Time to deliver one output batch to all attached clients.\n")
+	fmt.Fprintf(w, "# TYPE pty_daemon_broadcast_seconds histogram\n")
+	var cum uint64
+	for i, b := range latencyBuckets {
+		cum += h.counts[i]
+		fmt.Fprintf(w, "pty_daemon_broadcast_seconds_bucket{le=\"%g\"} %d\n", b.Seconds(), cum)
+	}
+	fmt.Fprintf(w, "pty_daemon_broadcast_seconds_bucket{le=\"+Inf\"} %d\n", h.n)
+	fmt.Fprintf(w, "pty_daemon_broadcast_seconds_sum %g\n", h.sum.Seconds())
+	fmt.Fprintf(w, "pty_daemon_broadcast_seconds_count %d\n", h.n)
+	h.mu.Unlock()
+}
+
+// serveMetrics starts the /metrics endpoint. It only binds loopback
+// addresses: session IDs and byte counts are nobody else's business.
+func serveMetrics(addr string, sm *SessionManager) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("metrics address %s is not loopback", addr)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writePrometheus(w, sm)
+	})
+	go func() {
+		if err := http.Serve(ln, mux); err != nil {
+			slog.Warn("metrics.stopped", "err", err)
+		}
+	}()
+	return nil
+}
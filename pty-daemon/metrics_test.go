@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistogram_Snapshot(t *testing.T) {
+	h := newHistogram()
+	for i := 0; i < 99; i++ {
+		h.Observe(200 * time.Microsecond)
+	}
+	h.Observe(2 * time.Second)
+	st := h.Snapshot()
+	if st.Count != 100 {
+		t.Fatalf("expected 100 observations, got %d", st.Count)
+	}
+	if st.P99Us != 500 {
+		t.Fatalf("expected p99 in the 500µs bucket, got %dµs", st.P99Us)
+	}
+	if st.MaxUs != 2_000_000 {
+		t.Fatalf("expected max 2s, got %dµs", st.MaxUs)
+	}
+}
+
+func TestWritePrometheus(t *testing.T) {
+	sm := NewSessionManager(func(string, string, uint64) {}, func(string, int, int, ExitDetail) {})
+	var b strings.Builder
+	writePrometheus(&b, sm)
+	for _, want := range []string{
+		`pty_daemon_sessions{state="alive"} 0`,
+		"# TYPE pty_daemon_broadcast_seconds histogram",
+		`pty_daemon_broadcast_seconds_bucket{le="+Inf"}`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("missing %q in output:\n%s", want, b.String())
+		}
+	}
+}
+
+func TestServeMetrics_RejectsNonLoopback(t *testing.T) {
+	if err := serveMetrics("0.0.0.0:0", nil); err == nil {
+		t.Fatal("expected non-loopback address to be refused")
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DECSET private modes the daemon acts on.
+const (
+	modeAppCursor      = 1    // DECCKM: cursor keys send ESC O A rather than ESC [ A
+	modeBracketedPaste = 2004 // pastes are wrapped in ESC [200~ … ESC [201~
+)
+
+// isAltScreenMode reports whether a private mode switches to the
+// alternate screen: xterm's 47 and 1047, or 1049, which also saves the
+// cursor and is what most programs use.
+func isAltScreenMode(n int) bool { return n == 47 || n == 1047 || n == 1049 }
+
+// screenMarks are output offsets after which what came before no longer
+// shows on screen, so a replay can start there.
+type screenMarks struct {
+	Clear    uint64 // last full clear or reset of the normal screen
+	InAlt    bool   // the alternate screen is active
+	AltMode  int    // the mode that switched to it
+	Alt      uint64 // where it was entered
+	AltClear uint64 // last full clear of it, or Alt
+}
+
+// modeTracker follows the DECSET/DECRST private modes (CSI ? Pm h / l) an
+// application turns on in its output, and where it last cleared the
+// screen. It is fed the output in order and keeps parser state between
+// chunks, so sequences split across reads are still seen.
+type modeTracker struct {
+	mu     sync.Mutex
+	on     map[int]bool // modes set (true) or reset (false) since the last RIS
+	parser ansiState
+
+	offset   uint64 // stream offset of the next byte fed
+	seqStart uint64 // offset of the ESC starting the current sequence
+	// A clear usually comes just after a cursor move (ESC[H ESC[2J), and
+	// the replay must keep it, so runs of adjacent cursor moves and clears
+	// are tracked and a clear's mark is the start of its run.
+	runStart, runEnd uint64
+	marks            screenMarks
+}
+
+func newModeTracker() *modeTracker {
+	return &modeTracker{on: make(map[int]bool)}
+}
+
+// feed scans output for mode changes and clears.
+func (t *modeTracker) feed(data []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, b := range data {
+		pos := t.offset + uint64(i)
+		switch t.parser.feed(b) {
+		case ansiCSI:
+			t.final(b, pos+1)
+		case ansiReset:
+			clear(t.on)
+			t.marks = screenMarks{Clear: t.seqStart}
+		default:
+			if b == 0x1b && t.parser.state == parseEsc {
+				t.seqStart = pos
+			}
+		}
+	}
+	t.offset += uint64(len(data))
+}
+
+// final handles a complete CSI sequence ending at end. Caller holds t.mu.
+func (t *modeTracker) final(b byte, end uint64) {
+	params := string(t.parser.params)
+	switch {
+	case t.parser.kind == '?' && (b == 'h' || b == 'l'):
+		t.apply(params, b == 'h')
+	case t.parser.kind == 0 && (b == 'H' || b == 'f' || b == 'J'):
+		if t.seqStart != t.runEnd {
+			t.runStart = t.seqStart
+		}
+		t.runEnd = end
+		// ED 2 erases the screen, ED 3 the scrollback too.
+		if b == 'J' && (params == "2" || params == "3") {
+			if t.marks.InAlt {
+				t.marks.AltClear = t.runStart
+			} else {
+				t.marks.Clear = t.runStart
+			}
+		}
+	}
+}
+
+// apply sets or resets each mode in params. Caller holds t.mu.
+func (t *modeTracker) apply(params string, set bool) {
+	if strings.Contains(params, ":") {
+		return // sub-parameters don't belong in a mode list
+	}
+	n, have := 0, false
+	flush := func() {
+		if have {
+			t.on[n] = set
+			switch {
+			case !isAltScreenMode(n):
+			case set && !t.marks.InAlt:
+				t.marks.InAlt, t.marks.AltMode = true, n
+				t.marks.Alt, t.marks.AltClear = t.seqStart, t.seqStart
+			case !set && t.marks.InAlt:
+				t.marks.InAlt = false
+			}
+		}
+		n, have = 0, false
+	}
+	for _, b := range []byte(params) {
+		if b == ';' {
+			flush()
+			continue
+		}
+		if n < 100000 {
+			n = n*10 + int(b-'0')
+		}
+		have = true
+	}
+	flush()
+}
+
+// enabled reports whether the application has a mode turned on.
+func (t *modeTracker) enabled(mode int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.on[mode]
+}
+
+// list returns the modes currently on, ascending.
+func (t *modeTracker) list() []int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := []int{}
+	for _, m := range sortedKeys(t.on) {
+		if t.on[m] {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// screen returns the current marks, and the sequences that put every mode
+// the application has changed, other than the alternate screen, into its
+// current state.
+func (t *modeTracker) screen() (screenMarks, []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var set, reset []string
+	for _, m := range sortedKeys(t.on) {
+		switch {
+		case isAltScreenMode(m):
+		case t.on[m]:
+			set = append(set, strconv.Itoa(m))
+		default:
+			reset = append(reset, strconv.Itoa(m))
+		}
+	}
+	var seq []byte
+	if len(set) > 0 {
+		seq = append(seq, "\x1b[?"+strings.Join(set, ";")+"h"...)
+	}
+	if len(reset) > 0 {
+		seq = append(seq, "\x1b[?"+strings.Join(reset, ";")+"l"...)
+	}
+	return t.marks, seq
+}
+
+func sortedKeys(m map[int]bool) []int {
+	out := make([]int, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Ints(out)
+	return out
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestModeTracker(t *testing.T) {
+	m := newModeTracker()
+	m.feed([]byte("hello \x1b[?1;2004h world"))
+	if got := m.list(); !slices.Equal(got, []int{1, 2004}) {
+		t.Fatalf("expected [1 2004], got %v", got)
+	}
+
+	// Split across reads, with unrelated sequences in between.
+	m.feed([]byte("\x1b[31mred\x1b[0m\x1b[?20"))
+	m.feed([]byte("04l"))
+	if m.enabled(modeBracketedPaste) || !m.enabled(modeAppCursor) {
+		t.Fatalf("expected only mode 1, got %v", m.list())
+	}
+
+	// Non-private and intermediate-byte sequences aren't DECSET.
+	m.feed([]byte("\x1b[4h\x1b[?5$p\x1b[>1h"))
+	if got := m.list(); !slices.Equal(got, []int{1}) {
+		t.Fatalf("expected [1], got %v", got)
+	}
+
+	// RIS resets everything.
+	m.feed([]byte("\x1b[?1049h\x1bc"))
+	if got := m.list(); len(got) != 0 {
+		t.Fatalf("expected no modes after RIS, got %v", got)
+	}
+}
+
+func TestModeTracker_ScreenMarks(t *testing.T) {
+	m := newModeTracker()
+	out := "$ ls\r\nfoo\r\n$ clear\r\n\x1b[H\x1b[2J\x1b[3J$ vim\r\n"
+	m.feed([]byte(out))
+	marks, _ := m.screen()
+	if want := uint64(strings.Index(out, "\x1b[H")); marks.Clear != want || marks.InAlt {
+		t.Fatalf("expected the clear marked at the cursor move before it (%d), got %+v", want, marks)
+	}
+
+	alt := uint64(len(out))
+	m.feed([]byte("\x1b[?1049h\x1b[?25l\x1b[22;1Hfirst draw"))
+	redraw := alt + uint64(len("\x1b[?1049h\x1b[?25l\x1b[22;1Hfirst draw"))
+	m.feed([]byte("\x1b[2Jsecond draw"))
+	marks, modes := m.screen()
+	if !marks.InAlt || marks.AltMode != 1049 || marks.Alt != alt || marks.AltClear != redraw {
+		t.Fatalf("expected alt screen at %d, cleared at %d; got %+v", alt, redraw, marks)
+	}
+	if string(modes) != "\x1b[?25l" {
+		t.Fatalf("expected the hidden cursor restored, got %q", modes)
+	}
+
+	m.feed([]byte("\x1b[?1049l"))
+	if marks, _ := m.screen(); marks.InAlt || marks.Clear != uint64(strings.Index(out, "\x1b[H")) {
+		t.Fatalf("leaving the alt screen should restore the normal marks, got %+v", marks)
+	}
+}
+
+func TestModeTracker_SkipsStringsAndSubParameters(t *testing.T) {
+	m := newModeTracker()
+	// A window title that happens to contain a DECSET isn't one.
+	m.feed([]byte("\x1b]0;\x1b[?2004h\x07\x1b]2;x\x1b[?1h\x1b\\"))
+	m.feed([]byte("\x1b[?1:2h"))
+	if got := m.list(); len(got) != 0 {
+		t.Fatalf("expected no modes, got %v", got)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// maxOutputBatch bounds how much output one batch holds. When a batch is
+// full the reader waits for it to be sent, so a flood of output is paced
+// by the flush rate rather than buffered without limit. JSON escaping can
+// grow a batch several times over, so this stays well below what clients
+// will accept on one line.
+const maxOutputBatch = 256 * 1024
+
+// outputBatcher gathers a session's PTY output between flushes, so a
+// process writing in many small pieces reaches clients as a few larger
+// data events instead of one per read.
+type outputBatcher struct {
+	mu     sync.Mutex
+	cond   *sync.Cond // signalled when the batch is taken
+	buf    []byte
+	closed bool
+	kick   chan struct{} // output or close is waiting
+	done   chan struct{} // closed once run has returned
+}
+
+func newOutputBatcher() *outputBatcher {
+	b := &outputBatcher{kick: make(chan struct{}, 1), done: make(chan struct{})}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// add appends output to the batch, waiting first if it is full.
+func (b *outputBatcher) add(data []byte) {
+	b.mu.Lock()
+	for len(b.buf) >= maxOutputBatch && !b.closed {
+		b.cond.Wait()
+	}
+	b.buf = append(b.buf, data...)
+	b.mu.Unlock()
+	b.wake()
+}
+
+func (b *outputBatcher) wake() {
+	select {
+	case b.kick <- struct{}{}:
+	default:
+	}
+}
+
+// close flushes whatever is left and waits for run to return, so nothing
+// the process wrote can arrive after its exit event.
+func (b *outputBatcher) close() {
+	b.mu.Lock()
+	b.closed = true
+	b.cond.Broadcast()
+	b.mu.Unlock()
+	b.wake()
+	<-b.done
+}
+
+// run sends batches to flush until the batcher is closed. Once output
+// arrives it waits as long as wait says, given when the last batch went
+// out, then sends everything gathered meanwhile.
+func (b *outputBatcher) run(wait func(last time.Time) time.Duration, flush func([]byte)) {
+	defer close(b.done)
+	var last time.Time
+	for range b.kick {
+		b.mu.Lock()
+		closed := b.closed
+		b.mu.Unlock()
+		if !closed {
+			if d := wait(last); d > 0 {
+				time.Sleep(d)
+			}
+		}
+
+		b.mu.Lock()
+		data := b.buf
+		b.buf = nil
+		closed = b.closed
+		b.cond.Broadcast()
+		b.mu.Unlock()
+
+		if len(data) > 0 {
+			flush(data)
+			last = time.Now()
+		}
+		if closed {
+			return
+		}
+	}
+}
+
+// outputWait paces flushes by the config: at least the coalescing window,
+// and no sooner after the last batch than the rate cap allows.
+func outputWait(last time.Time) time.Duration {
+	cfg := currentConfig()
+	d := time.Duration(cfg.OutputCoalesce)
+	if cfg.OutputMaxRate > 0 {
+		if gap := time.Second/time.Duration(cfg.OutputMaxRate) - time.Since(last); gap > d {
+			d = gap
+		}
+	}
+	return d
+}
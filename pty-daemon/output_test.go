@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collect runs b with a fixed wait, returning a function that closes it
+// and yields the batches it flushed.
+func collect(b *outputBatcher, wait time.Duration) func() [][]byte {
+	var mu sync.Mutex
+	var batches [][]byte
+	go b.run(func(time.Time) time.Duration { return wait }, func(data []byte) {
+		mu.Lock()
+		batches = append(batches, bytes.Clone(data))
+		mu.Unlock()
+	})
+	return func() [][]byte {
+		b.close()
+		mu.Lock()
+		defer mu.Unlock()
+		return batches
+	}
+}
+
+func TestOutputBatcher_Coalesces(t *testing.T) {
+	b := newOutputBatcher()
+	finish := collect(b, 50*time.Millisecond)
+	for i := 0; i < 100; i++ {
+		b.add([]byte("x"))
+	}
+	time.Sleep(150 * time.Millisecond)
+	batches := finish()
+	if len(batches) != 1 || len(batches[0]) != 100 {
+		t.Fatalf("expected one batch of 100 bytes, got %d batches", len(batches))
+	}
+}
+
+func TestOutputBatcher_CloseFlushes(t *testing.T) {
+	b := newOutputBatcher()
+	finish := collect(b, time.Hour)
+	b.add([]byte("last words"))
+	batches := finish()
+	if len(batches) != 1 || string(batches[0]) != "last words" {
+		t.Fatalf("expected the pending output on close, got %q", batches)
+	}
+}
+
+func TestOutputBatcher_FullBatchWaits(t *testing.T) {
+	b := newOutputBatcher()
+	b.add(make([]byte, maxOutputBatch))
+
+	added := make(chan struct{})
+	go func() {
+		b.add([]byte("more"))
+		close(added)
+	}()
+	select {
+	case <-added:
+		t.Fatal("add into a full batch should wait for it to be sent")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	finish := collect(b, 0)
+	<-added
+	total := 0
+	for _, batch := range finish() {
+		total += len(batch)
+	}
+	if total != maxOutputBatch+4 {
+		t.Fatalf("expected %d bytes flushed, got %d", maxOutputBatch+4, total)
+	}
+}
+
+func TestOutputWait_RateCap(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.OutputCoalesce = duration(time.Millisecond)
+	cfg.OutputMaxRate = 10
+	config.Store(&cfg)
+	t.Cleanup(func() { def := defaultConfig(); config.Store(&def) })
+
+	if d := outputWait(time.Time{}); d != time.Millisecond {
+		t.Fatalf("long after the last batch, expected the coalescing window, got %v", d)
+	}
+	if d := outputWait(time.Now()); d < 90*time.Millisecond {
+		t.Fatalf("right after a batch, expected to wait out the rate cap, got %v", d)
+	}
+}
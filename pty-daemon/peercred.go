@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// allowedUidsEnv names extra uids (comma-separated) that may connect to the
+// control socket in addition to the daemon's own uid. Setting any opens up
+// the socket's permissions (see socketModes).
+const allowedUidsEnv = "SPACETERM_PTY_ALLOWED_UIDS"
+
+// PeerCred identifies the process on the other end of a unix socket.
+// Pid is 0 on platforms that don't report it.
+type PeerCred struct {
+	Uid uint32
+	Gid uint32
+	Pid int32
+}
+
+// PeerPolicy decides which peers may talk to the daemon.
+type PeerPolicy struct {
+	allowed map[uint32]bool
+}
+
+// NewPeerPolicy allows the daemon's own uid plus any extra uids.
+func NewPeerPolicy(extra []uint32) *PeerPolicy {
+	p := &PeerPolicy{allowed: map[uint32]bool{uint32(os.Getuid()): true}}
+	for _, uid := range extra {
+		p.allowed[uid] = true
+	}
+	return p
+}
+
+// Allows reports whether the peer may use the control socket.
+func (p *PeerPolicy) Allows(cred PeerCred) bool {
+	return p.allowed[cred.Uid]
+}
+
+// parseUidList parses a comma-separated list of numeric uids.
+// Empty entries are ignored so a trailing comma is harmless.
+func parseUidList(s string) ([]uint32, error) {
+	var out []uint32
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		uid, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid uid %q", field)
+		}
+		out = append(out, uint32(uid))
+	}
+	return out, nil
+}
+
+// readPeerCred fetches the kernel-verified credentials of a unix socket peer.
+func readPeerCred(conn net.Conn) (PeerCred, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return PeerCred{}, fmt.Errorf("not a unix socket: %T", conn)
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return PeerCred{}, err
+	}
+	var cred PeerCred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = getPeerCred(int(fd))
+	}); err != nil {
+		return PeerCred{}, err
+	}
+	return cred, credErr
+}
+
+// socketModes returns the permissions of the socket's directory and of the
+// socket itself. They are owner-only unless other uids are allowed in,
+// which needs them to be able to reach the socket (search, not list, the
+// directory) and connect to it; SO_PEERCRED then turns away anyone else.
+func socketModes(shared bool) (dir, sock os.FileMode) {
+	if shared {
+		return 0711, 0666
+	}
+	return 0700, 0600
+}
+
+// ensurePrivateDir creates dir with mode 0700, or tightens an existing one.
+// It refuses to use a directory owned by another user or a symlink, since
+// either would let someone else swap the socket out from under us.
+func ensurePrivateDir(dir string) error {
+	return ensureDirMode(dir, 0700)
+}
+
+// ensureSocketDir is ensurePrivateDir for the spaceterm home, which other
+// uids may search when they are allowed to connect.
+func ensureSocketDir(dir string, shared bool) error {
+	mode, _ := socketModes(shared)
+	return ensureDirMode(dir, mode)
+}
+
+func ensureDirMode(dir string, mode os.FileMode) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	fi, err := ownDir(dir)
+	if err != nil {
+		return err
+	}
+	if fi.Mode().Perm() != mode {
+		return os.Chmod(dir, mode)
+	}
+	return nil
+}
+
+// checkSocketDir is ensureSocketDir for a directory we don't own the
+// layout of, such as the parent of a configured socket path: it must
+// already exist, be ours and be closed to group and others beyond what
+// socketModes allows. It never changes it.
+func checkSocketDir(dir string, shared bool) error {
+	fi, err := ownDir(dir)
+	if err != nil {
+		return err
+	}
+	mode, _ := socketModes(shared)
+	if perm := fi.Mode().Perm(); perm&^mode != 0 {
+		return fmt.Errorf("%s has mode %o; make it chmod %o or choose another socketPath", dir, perm, mode)
+	}
+	return nil
+}
+
+// listenSocket creates the control socket with its final permissions from
+// the start, so there is no window in which it is more open.
+func listenSocket(path string, shared bool) (net.Listener, error) {
+	_, mode := socketModes(shared)
+	oldMask := syscall.Umask(int(0777 &^ mode))
+	defer syscall.Umask(oldMask)
+	return net.Listen("unix", path)
+}
+
+// ownDir checks that dir is a real directory owned by us.
+func ownDir(dir string) (os.FileInfo, error) {
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	if uid, ok := fileOwner(fi); ok && uid != uint32(os.Getuid()) {
+		return nil, fmt.Errorf("%s is owned by uid %d, not %d", dir, uid, os.Getuid())
+	}
+	return fi, nil
+}
+
+// fileOwner returns the uid owning a file, if the platform reports one.
+func fileOwner(fi os.FileInfo) (uint32, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return st.Uid, true
+}
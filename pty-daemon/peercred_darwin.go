@@ -0,0 +1,41 @@
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// Values from <sys/un.h> and <sys/ucred.h>; the syscall package doesn't
+// export them for darwin.
+const (
+	solLocal      = 0
+	localPeercred = 0x001
+	xucredVersion = 0
+)
+
+// xucred mirrors struct xucred from <sys/ucred.h>.
+type xucred struct {
+	Version uint32
+	Uid     uint32
+	Ngroups int16
+	Groups  [16]uint32
+}
+
+// getPeerCred reads LOCAL_PEERCRED. Darwin doesn't report the peer pid here.
+func getPeerCred(fd int) (PeerCred, error) {
+	var xc xucred
+	size := uint32(unsafe.Sizeof(xc))
+	_, _, errno := syscall.Syscall6(syscall.SYS_GETSOCKOPT, uintptr(fd), solLocal, localPeercred,
+		uintptr(unsafe.Pointer(&xc)), uintptr(unsafe.Pointer(&size)), 0)
+	if errno != 0 {
+		return PeerCred{}, errno
+	}
+	if xc.Version != xucredVersion {
+		return PeerCred{}, syscall.EINVAL
+	}
+	cred := PeerCred{Uid: xc.Uid}
+	if xc.Ngroups > 0 {
+		cred.Gid = xc.Groups[0]
+	}
+	return cred, nil
+}
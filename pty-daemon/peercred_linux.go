@@ -0,0 +1,12 @@
+package main
+
+import "syscall"
+
+// getPeerCred reads SO_PEERCRED, which the kernel fills in at connect time.
+func getPeerCred(fd int) (PeerCred, error) {
+	ucred, err := syscall.GetsockoptUcred(fd, syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	if err != nil {
+		return PeerCred{}, err
+	}
+	return PeerCred{Uid: ucred.Uid, Gid: ucred.Gid, Pid: ucred.Pid}, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+)
+
+// dialAs connects to a unix socket with the effective uid set to uid. The
+// change is made on a locked thread that exits afterwards, so the rest of
+// the process keeps its own credentials.
+func dialAs(uid int, path string) error {
+	done := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread() // never unlocked: the thread dies with us
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_SETRESUID, ^uintptr(0), uintptr(uid), ^uintptr(0)); errno != 0 {
+			done <- errno
+			return
+		}
+		fd, err := syscall.Socket(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+		if err != nil {
+			done <- err
+			return
+		}
+		// The peer's credentials are taken at connect, so closing right
+		// away still leaves a connection to accept and check.
+		err = syscall.Connect(fd, &syscall.SockaddrUnix{Name: path})
+		syscall.Close(fd)
+		done <- err
+	}()
+	return <-done
+}
+
+func TestListenSocket_AllowedUidCanConnect(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("needs root to connect as another uid")
+	}
+	const nobody = 65534
+	base := t.TempDir()
+	// t.TempDir's parent is private to us; let others search it.
+	if err := os.Chmod(filepath.Dir(base), 0711); err != nil {
+		t.Fatal(err)
+	}
+	for _, shared := range []bool{false, true} {
+		dir := filepath.Join(base, "private")
+		if shared {
+			dir = filepath.Join(base, "shared")
+		}
+		if err := ensureSocketDir(dir, shared); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, "s.sock")
+		ln, err := listenSocket(path, shared)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+
+		err = dialAs(nobody, path)
+		if !shared {
+			if !errors.Is(err, syscall.EACCES) {
+				t.Fatalf("expected an owner-only socket to refuse another uid, got %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("expected another uid to reach the socket, got %v", err)
+		}
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		cred, err := readPeerCred(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cred.Uid != nobody {
+			t.Fatalf("expected uid %d, got %d", nobody, cred.Uid)
+		}
+		if !NewPeerPolicy([]uint32{nobody}).Allows(cred) {
+			t.Fatal("expected the allow-listed uid to be accepted")
+		}
+		if NewPeerPolicy(nil).Allows(cred) {
+			t.Fatal("expected the uid to be rejected without the allow-list")
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package main
+
+import "errors"
+
+// getPeerCred is unsupported here, so every peer is rejected.
+func getPeerCred(fd int) (PeerCred, error) {
+	return PeerCred{}, errors.New("peer credentials not supported on this platform")
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseUidList(t *testing.T) {
+	got, err := parseUidList(" 1001, 1002,,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != 1001 || got[1] != 1002 {
+		t.Fatalf("expected [1001 1002], got %v", got)
+	}
+	if _, err := parseUidList("bob"); err == nil {
+		t.Fatal("expected error for non-numeric uid")
+	}
+}
+
+func TestPeerPolicy_AllowsOwnUidAndExtras(t *testing.T) {
+	p := NewPeerPolicy([]uint32{4242})
+	if !p.Allows(PeerCred{Uid: uint32(os.Getuid())}) {
+		t.Fatal("own uid should be allowed")
+	}
+	if !p.Allows(PeerCred{Uid: 4242}) {
+		t.Fatal("allowlisted uid should be allowed")
+	}
+	if p.Allows(PeerCred{Uid: 4243}) {
+		t.Fatal("unlisted uid should be rejected")
+	}
+}
+
+func TestReadPeerCred_Self(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "s.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		c, err := net.Dial("unix", path)
+		if err == nil {
+			defer c.Close()
+			c.Read(make([]byte, 1))
+		}
+	}()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	cred, err := readPeerCred(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred.Uid != uint32(os.Getuid()) {
+		t.Fatalf("expected uid %d, got %d", os.Getuid(), cred.Uid)
+	}
+}
+
+func TestCheckSocketDir_NeverChmods(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "shared")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSocketDir(dir, false); err == nil {
+		t.Fatal("expected a group/world-readable directory to be refused")
+	}
+	if err := checkSocketDir(dir, true); err == nil {
+		t.Fatal("expected a world-listable directory to be refused even with allowed uids")
+	}
+	if fi, _ := os.Stat(dir); fi.Mode().Perm() != 0755 {
+		t.Fatalf("expected the mode left at 0755, got %o", fi.Mode().Perm())
+	}
+	if err := os.Chmod(dir, 0711); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSocketDir(dir, true); err != nil {
+		t.Fatalf("expected a searchable directory to pass with allowed uids, got %v", err)
+	}
+	if err := checkSocketDir(dir, false); err == nil {
+		t.Fatal("expected a searchable directory to be refused without allowed uids")
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSocketDir(dir, false); err != nil {
+		t.Fatalf("expected a private directory to pass, got %v", err)
+	}
+	if err := checkSocketDir(filepath.Join(dir, "missing"), false); err == nil {
+		t.Fatal("expected a missing directory to be refused")
+	}
+}
+
+func TestEnsurePrivateDir_Tightens(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "home")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ensurePrivateDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	fi, _ := os.Stat(dir)
+	if fi.Mode().Perm() != 0700 {
+		t.Fatalf("expected 0700, got %o", fi.Mode().Perm())
+	}
+}
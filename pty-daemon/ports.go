@@ -0,0 +1,61 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+)
+
+// listenKey identifies a listening socket independent of which process of
+// a prefork server happens to be reported for it.
+func listenKey(p ListenPort) string {
+	return p.Addr + "|" + strconv.Itoa(p.Port)
+}
+
+// sessionPorts collects the distinct ports held by pids, a session's
+// process tree parents first, from what listeningPorts found. A socket
+// shared by several processes is reported once, for the first of them.
+func sessionPorts(pids []int, found map[int][]ListenPort) []ListenPort {
+	seen := make(map[string]bool)
+	var out []ListenPort
+	for _, pid := range pids {
+		for _, p := range found[pid] {
+			if !seen[listenKey(p)] {
+				seen[listenKey(p)] = true
+				out = append(out, p)
+			}
+		}
+	}
+	sortPorts(out)
+	return out
+}
+
+// sortPorts orders ports for stable output in SessionInfo.
+func sortPorts(ports []ListenPort) {
+	sort.Slice(ports, func(i, j int) bool {
+		if ports[i].Port != ports[j].Port {
+			return ports[i].Port < ports[j].Port
+		}
+		return ports[i].Addr < ports[j].Addr
+	})
+}
+
+// diffPorts returns the ports that appeared in next and disappeared from prev.
+func diffPorts(prev, next []ListenPort) (opened, closed []ListenPort) {
+	before := make(map[string]bool, len(prev))
+	for _, p := range prev {
+		before[listenKey(p)] = true
+	}
+	after := make(map[string]bool, len(next))
+	for _, p := range next {
+		after[listenKey(p)] = true
+		if !before[listenKey(p)] {
+			opened = append(opened, p)
+		}
+	}
+	for _, p := range prev {
+		if !after[listenKey(p)] {
+			closed = append(closed, p)
+		}
+	}
+	return opened, closed
+}
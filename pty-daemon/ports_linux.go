@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// tcpListen is TCP_LISTEN in the st column of /proc/net/tcp.
+const tcpListen = "0A"
+
+// listeningPorts returns the TCP ports each of pids is listening on, found
+// by matching the socket inodes in each process's fd table against the
+// kernel's listening sockets. The socket tables are read once per call, so
+// callers should pass every pid they are interested in together.
+func listeningPorts(pids []int) (map[int][]ListenPort, error) {
+	listeners := make(map[string]ListenPort) // inode → port
+	for _, file := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		if err := readListeners(file, listeners); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	if len(listeners) == 0 {
+		return nil, nil
+	}
+
+	out := make(map[int][]ListenPort)
+	for _, pid := range pids {
+		dir := fmt.Sprintf("/proc/%d/fd", pid)
+		fds, err := os.ReadDir(dir)
+		if err != nil {
+			continue // exited, or not ours to inspect
+		}
+		for _, fd := range fds {
+			target, err := os.Readlink(dir + "/" + fd.Name())
+			if err != nil {
+				continue
+			}
+			inode, ok := strings.CutPrefix(target, "socket:[")
+			if !ok {
+				continue
+			}
+			if p, ok := listeners[strings.TrimSuffix(inode, "]")]; ok {
+				p.Pid = pid
+				out[pid] = append(out[pid], p)
+			}
+		}
+	}
+	return out, nil
+}
+
+// readListeners adds the listening sockets from a /proc/net/tcp{,6} file.
+func readListeners(path string, into map[string]ListenPort) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Scan() // header
+	for sc.Scan() {
+		// sl local_address rem_address st tx:rx tr:when retrnsmt uid timeout inode
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 10 || fields[3] != tcpListen {
+			continue
+		}
+		addr, port, ok := parseProcNetAddr(fields[1])
+		if !ok {
+			continue
+		}
+		into[fields[9]] = ListenPort{Port: port, Addr: addr}
+	}
+	return sc.Err()
+}
+
+// parseProcNetAddr decodes "0100007F:1F90" into ("127.0.0.1", 8080). The
+// address is hex in host byte order, one 32-bit word at a time, which is
+// little-endian on every architecture we run on.
+func parseProcNetAddr(s string) (string, int, bool) {
+	hexAddr, hexPort, ok := strings.Cut(s, ":")
+	if !ok {
+		return "", 0, false
+	}
+	port, err := strconv.ParseUint(hexPort, 16, 16)
+	if err != nil {
+		return "", 0, false
+	}
+	raw, err := hex.DecodeString(hexAddr)
+	if err != nil || (len(raw) != 4 && len(raw) != 16) {
+		return "", 0, false
+	}
+	ip := make(net.IP, len(raw))
+	for w := 0; w < len(raw); w += 4 {
+		ip[w], ip[w+1], ip[w+2], ip[w+3] = raw[w+3], raw[w+2], raw[w+1], raw[w]
+	}
+	return ip.String(), int(port), true
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net"
+	"os"
+	"testing"
+)
+
+func TestParseProcNetAddr(t *testing.T) {
+	addr, port, ok := parseProcNetAddr("0100007F:1F90")
+	if !ok || addr != "127.0.0.1" || port != 8080 {
+		t.Fatalf("expected 127.0.0.1:8080, got %s:%d (ok=%v)", addr, port, ok)
+	}
+	addr, port, ok = parseProcNetAddr("00000000000000000000000001000000:0050")
+	if !ok || addr != "::1" || port != 80 {
+		t.Fatalf("expected [::1]:80, got %s:%d (ok=%v)", addr, port, ok)
+	}
+}
+
+func TestListeningPorts_Self(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("no loopback TCP:", err)
+	}
+	defer ln.Close()
+	want := ln.Addr().(*net.TCPAddr).Port
+
+	found, err := listeningPorts([]int{os.Getpid()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range found[os.Getpid()] {
+		if p.Port == want && p.Pid == os.Getpid() {
+			return
+		}
+	}
+	t.Fatalf("expected port %d in %+v", want, found)
+}
@@ -0,0 +1,55 @@
+//go:build !linux
+
+package main
+
+import (
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// listeningPorts asks lsof which of pids hold listening TCP sockets, and
+// returns them by pid. It runs lsof once per call, so callers should pass
+// every pid they are interested in together.
+func listeningPorts(pids []int) (map[int][]ListenPort, error) {
+	if len(pids) == 0 {
+		return nil, nil
+	}
+	strs := make([]string, len(pids))
+	for i, pid := range pids {
+		strs[i] = strconv.Itoa(pid)
+	}
+	// -a ANDs the selections; -F pn prints "p<pid>" then "n<addr:port>" lines.
+	out, err := exec.Command("lsof", "-a", "-nP", "-iTCP", "-sTCP:LISTEN",
+		"-p", strings.Join(strs, ","), "-Fpn").Output()
+	if err != nil {
+		// lsof exits 1 when nothing matched.
+		if ee, ok := err.(*exec.ExitError); ok && ee.ExitCode() == 1 {
+			return nil, nil
+		}
+		return nil, err
+	}
+	ports := make(map[int][]ListenPort)
+	pid := 0
+	for _, line := range strings.Split(string(out), "\n") {
+		switch {
+		case strings.HasPrefix(line, "p"):
+			pid, _ = strconv.Atoi(line[1:])
+		case strings.HasPrefix(line, "n"):
+			host, portStr, err := net.SplitHostPort(line[1:])
+			if err != nil {
+				continue
+			}
+			port, err := strconv.Atoi(portStr)
+			if err != nil {
+				continue
+			}
+			if host == "*" {
+				host = "0.0.0.0"
+			}
+			ports[pid] = append(ports[pid], ListenPort{Port: port, Addr: host, Pid: pid})
+		}
+	}
+	return ports, nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestDiffPorts(t *testing.T) {
+	prev := []ListenPort{{Port: 3000, Addr: "127.0.0.1", Pid: 10}, {Port: 5173, Addr: "::", Pid: 11}}
+	next := []ListenPort{{Port: 5173, Addr: "::", Pid: 12}, {Port: 8080, Addr: "0.0.0.0", Pid: 10}}
+	opened, closed := diffPorts(prev, next)
+	if len(opened) != 1 || opened[0].Port != 8080 {
+		t.Fatalf("expected 8080 opened, got %+v", opened)
+	}
+	if len(closed) != 1 || closed[0].Port != 3000 {
+		t.Fatalf("expected 3000 closed, got %+v", closed)
+	}
+}
+
+func TestSessionPorts(t *testing.T) {
+	// A prefork server: the parent and a worker share one listener.
+	found := map[int][]ListenPort{
+		10: {{Port: 8080, Addr: "0.0.0.0", Pid: 10}},
+		11: {{Port: 8080, Addr: "0.0.0.0", Pid: 11}, {Port: 3000, Addr: "::", Pid: 11}},
+		99: {{Port: 22, Addr: "0.0.0.0", Pid: 99}}, // another session's
+	}
+	got := sessionPorts([]int{10, 11}, found)
+	if len(got) != 2 || got[0].Port != 3000 || got[1].Port != 8080 || got[1].Pid != 10 {
+		t.Fatalf("expected 3000 and 8080 (from pid 10), got %+v", got)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// procStat is the slice of a process's status the daemon needs to reason
+// about a session's process tree.
+type procStat struct {
+	Pid      int
+	Ppid     int
+	Pgid     int
+	State    string        // single-letter ps state, e.g. "R", "S", "Z"
+	CPU      time.Duration // user + system time consumed so far
+	RSSBytes int64
+}
+
+// treeNode is a process positioned in a tree; Depth 0 is the root.
+type treeNode struct {
+	procStat
+	Depth int
+}
+
+// processTree returns root and every process below it in depth-first
+// order (so each parent precedes its children), siblings by pid.
+func processTree(procs []procStat, root int) []treeNode {
+	children := make(map[int][]procStat)
+	var rootProc *procStat
+	for i, p := range procs {
+		children[p.Ppid] = append(children[p.Ppid], p)
+		if p.Pid == root {
+			rootProc = &procs[i]
+		}
+	}
+	if rootProc == nil {
+		return nil
+	}
+	var out []treeNode
+	var walk func(p procStat, depth int)
+	walk = func(p procStat, depth int) {
+		out = append(out, treeNode{procStat: p, Depth: depth})
+		kids := children[p.Pid]
+		sort.Slice(kids, func(a, b int) bool { return kids[a].Pid < kids[b].Pid })
+		for _, k := range kids {
+			if k.Pid != p.Pid { // pid 0 is its own parent on some systems
+				walk(k, depth+1)
+			}
+		}
+	}
+	walk(*rootProc, 0)
+	return out
+}
+
+// descendants returns root and every process below it, parents first.
+func descendants(procs []procStat, root int) []procStat {
+	tree := processTree(procs, root)
+	if tree == nil {
+		return nil
+	}
+	out := make([]procStat, len(tree))
+	for i, n := range tree {
+		out[i] = n.procStat
+	}
+	return out
+}
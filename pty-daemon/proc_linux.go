@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// clockTicks is USER_HZ, the unit of utime/stime in /proc/<pid>/stat. It is
+// 100 on every mainstream Linux architecture, and reading the real value
+// would need cgo for sysconf.
+const clockTicks = 100
+
+// listProcs reads every process's stat file from /proc. Processes that
+// exit mid-scan are skipped.
+func listProcs() ([]procStat, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	out := make([]procStat, 0, len(entries))
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if err != nil {
+			continue
+		}
+		if st, ok := parseProcStat(data); ok {
+			out = append(out, st)
+		}
+	}
+	return out, nil
+}
+
+// procDetails returns a process's argv and working directory. Either may
+// be empty if the process exited or belongs to another user.
+func procDetails(pid int) (argv []string, cwd string) {
+	if data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid)); err == nil {
+		data = bytes.TrimRight(data, "\x00")
+		if len(data) > 0 {
+			for _, arg := range bytes.Split(data, []byte{0}) {
+				argv = append(argv, string(arg))
+			}
+		}
+	}
+	return argv, procCwd(pid)
+}
+
+// procCwd returns a process's working directory, or "" if it can't be read.
+func procCwd(pid int) string {
+	cwd, _ := os.Readlink(fmt.Sprintf("/proc/%d/cwd", pid))
+	return cwd
+}
+
+// parseProcStat parses the leading fields of /proc/<pid>/stat. The command
+// name is parenthesised and may itself contain spaces or parens, so fields
+// are split after the last ')'.
+func parseProcStat(data []byte) (procStat, bool) {
+	open := bytes.IndexByte(data, '(')
+	end := bytes.LastIndexByte(data, ')')
+	if open < 0 || end < open {
+		return procStat{}, false
+	}
+	pid, err := strconv.Atoi(string(bytes.TrimSpace(data[:open])))
+	if err != nil {
+		return procStat{}, false
+	}
+	// state ppid pgrp session tty_nr tpgid flags minflt cminflt majflt
+	// cmajflt utime stime cutime cstime priority nice num_threads
+	// itrealvalue starttime vsize rss
+	fields := bytes.Fields(data[end+1:])
+	if len(fields) < 22 {
+		return procStat{}, false
+	}
+	ppid, err1 := strconv.Atoi(string(fields[1]))
+	pgid, err2 := strconv.Atoi(string(fields[2]))
+	if err1 != nil || err2 != nil {
+		return procStat{}, false
+	}
+	utime, _ := strconv.ParseInt(string(fields[11]), 10, 64)
+	stime, _ := strconv.ParseInt(string(fields[12]), 10, 64)
+	rss, _ := strconv.ParseInt(string(fields[21]), 10, 64)
+	return procStat{
+		Pid:      pid,
+		Ppid:     ppid,
+		Pgid:     pgid,
+		State:    string(fields[0]),
+		CPU:      time.Duration(utime+stime) * time.Second / clockTicks,
+		RSSBytes: rss * int64(os.Getpagesize()),
+	}, true
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseProcStat_ParenInComm(t *testing.T) {
+	line := "4242 (evil) name) S 17 4242 4242 34816 4242 4194304 0 0 0 0 " +
+		"150 50 0 0 20 0 1 0 100 1000 3"
+	st, ok := parseProcStat([]byte(line))
+	if !ok {
+		t.Fatal("expected parse to succeed")
+	}
+	if st.Pid != 4242 || st.Ppid != 17 || st.Pgid != 4242 || st.State != "S" {
+		t.Fatalf("unexpected %+v", st)
+	}
+	if st.CPU != 2*time.Second {
+		t.Fatalf("expected 2s CPU, got %v", st.CPU)
+	}
+	if st.RSSBytes != 3*int64(os.Getpagesize()) {
+		t.Fatalf("expected 3 pages RSS, got %d", st.RSSBytes)
+	}
+}
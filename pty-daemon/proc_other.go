@@ -0,0 +1,88 @@
+//go:build !linux
+
+package main
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// listProcs asks ps for the process table, since there is no /proc here.
+func listProcs() ([]procStat, error) {
+	out, err := exec.Command("ps", "-axo", "pid=,ppid=,pgid=,state=,time=,rss=").Output()
+	if err != nil {
+		return nil, err
+	}
+	var procs []procStat
+	for _, line := range strings.Split(string(out), "\n") {
+		f := strings.Fields(line)
+		if len(f) < 6 {
+			continue
+		}
+		pid, err1 := strconv.Atoi(f[0])
+		ppid, err2 := strconv.Atoi(f[1])
+		pgid, err3 := strconv.Atoi(f[2])
+		if err1 != nil || err2 != nil || err3 != nil {
+			continue
+		}
+		rssKiB, _ := strconv.ParseInt(f[5], 10, 64)
+		procs = append(procs, procStat{
+			Pid:      pid,
+			Ppid:     ppid,
+			Pgid:     pgid,
+			State:    f[3][:1],
+			CPU:      parsePsTime(f[4]),
+			RSSBytes: rssKiB * 1024,
+		})
+	}
+	return procs, nil
+}
+
+// procDetails returns a process's command line and working directory via
+// ps and lsof. ps only reports the command line space-joined, so argv is
+// split on spaces and arguments containing spaces come back split.
+func procDetails(pid int) (argv []string, cwd string) {
+	p := strconv.Itoa(pid)
+	if out, err := exec.Command("ps", "-o", "command=", "-p", p).Output(); err == nil {
+		argv = strings.Fields(string(out))
+	}
+	return argv, procCwd(pid)
+}
+
+// procCwd returns a process's working directory, or "" if it can't be
+// read. There's no /proc to ask, so it forks lsof: callers on a timer
+// should only ask about processes that have done something.
+func procCwd(pid int) string {
+	out, err := exec.Command("lsof", "-a", "-d", "cwd", "-p", strconv.Itoa(pid), "-Fn").Output()
+	if err != nil {
+		return ""
+	}
+	var cwd string
+	for _, line := range strings.Split(string(out), "\n") {
+		if name, ok := strings.CutPrefix(line, "n"); ok {
+			cwd = name
+		}
+	}
+	return cwd
+}
+
+// parsePsTime parses ps's cumulative CPU time, "[[dd-]hh:]mm:ss[.ff]".
+// Unparseable input yields 0.
+func parsePsTime(s string) time.Duration {
+	var days int
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		days, _ = strconv.Atoi(s[:i])
+		s = s[i+1:]
+	}
+	var total float64
+	for _, part := range strings.Split(s, ":") {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0
+		}
+		total = total*60 + v
+	}
+	return time.Duration(days)*24*time.Hour + time.Duration(total*float64(time.Second))
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestProcesses_ListsChildAndRejectsForeignPid(t *testing.T) {
+	sm := newTestManager()
+	sess := startTestSession(t, sm, "ps1", "sleep 5 & wait")
+	time.Sleep(200 * time.Millisecond)
+
+	_, procs, err := sm.Processes("ps1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(procs) < 2 || procs[0].Pid != sess.Pid || procs[1].Depth != 1 {
+		t.Fatalf("expected leader plus child, got %+v", procs)
+	}
+	if _, err := sm.Signal("ps1", syscall.SIGTERM, targetPid, 1); err == nil {
+		t.Fatal("signalling a pid outside the session should fail")
+	}
+	if _, err := sm.Signal("ps1", syscall.SIGTERM, targetPid, procs[1].Pid); err != nil {
+		t.Fatalf("signalling a child failed: %v", err)
+	}
+}
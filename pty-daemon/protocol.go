@@ -14,6 +14,26 @@ type CreateRequest struct {
 	Env     map[string]string `json:"env"`
 	Cols    int               `json:"cols"`
 	Rows    int               `json:"rows"`
+	// ResizePolicy decides the PTY size when attached clients disagree:
+	// "smallest", "largest", "controller" (default) or "latest".
+	ResizePolicy string `json:"resizePolicy,omitempty"`
+	// Limits caps the session's resources. Enforced by a per-session
+	// cgroup; without cgroup delegation they are not enforced.
+	Limits *SessionLimits `json:"limits,omitempty"`
+	// Name is a display name for people; the ID stays the handle.
+	Name string `json:"name,omitempty"`
+	// Labels are short key/values that list can select on. Metadata is
+	// anything else a client wants kept with the session. Both are saved
+	// with its journal entry.
+	Labels   map[string]string `json:"labels,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// SessionLimits caps a session's resources. Zero fields are unlimited.
+type SessionLimits struct {
+	MemoryBytes int64   `json:"memoryBytes,omitempty"`
+	CPUs        float64 `json:"cpus,omitempty"` // e.g. 1.5 = one and a half cores
+	Pids        int     `json:"pids,omitempty"`
 }
 
 // WriteRequest sends input data to a PTY.
@@ -23,7 +43,123 @@ type WriteRequest struct {
 	Data string `json:"data"`
 }
 
-// ResizeRequest changes the PTY window size.
+// WriteManyRequest sends the same input to several sessions at once, like
+// tmux's synchronize-panes. Targets are IDs, the members of Group and the
+// live sessions matching Selector, combined. With AllOrNothing, input is
+// only sent if every target can take it.
+type WriteManyRequest struct {
+	Type         string   `json:"type"`
+	IDs          []string `json:"ids,omitempty"`
+	Group        string   `json:"group,omitempty"`
+	Selector     string   `json:"selector,omitempty"`
+	Data         string   `json:"data"`
+	AllOrNothing bool     `json:"allOrNothing,omitempty"`
+}
+
+// GroupRequest creates or changes a named session group. Set replaces the
+// members; Add and Remove then adjust them. A group left empty is deleted.
+type GroupRequest struct {
+	Type   string   `json:"type"`
+	Name   string   `json:"name"`
+	Set    []string `json:"set,omitempty"`
+	Add    []string `json:"add,omitempty"`
+	Remove []string `json:"remove,omitempty"`
+}
+
+// GroupsRequest lists the session groups.
+type GroupsRequest struct {
+	Type string `json:"type"`
+}
+
+// KeysRequest sends keys by name: "Enter", "Up", "F5", "PageDown", single
+// characters, and tmux-style modifiers such as "C-c", "M-x" or "S-Up".
+// Cursor keys follow the application's cursor key mode.
+type KeysRequest struct {
+	Type string   `json:"type"`
+	ID   string   `json:"id"`
+	Keys []string `json:"keys"`
+}
+
+// PasteRequest sends text as a paste. Bracketed forces bracketed paste on
+// or off; by default it is used when the application has enabled it.
+type PasteRequest struct {
+	Type      string `json:"type"`
+	ID        string `json:"id"`
+	Data      string `json:"data"`
+	Bracketed *bool  `json:"bracketed,omitempty"`
+}
+
+// HelloRequest sets options for the rest of the connection. Compression
+// lists encodings the client accepts for attach replays, most preferred
+// first ("gzip", or "none" to stop looking); ChunkSize, if set, streams
+// each replay as ReplayEvents of at most that many bytes rather than one
+// Scrollback string. A client that never says hello gets neither.
+type HelloRequest struct {
+	Type        string   `json:"type"`
+	Compression []string `json:"compression,omitempty"`
+	ChunkSize   int      `json:"chunkSize,omitempty"`
+}
+
+// PauseRequest, with type "pause", stops the daemon reading a session's
+// output until a "resume", so a process writing faster than clients can
+// keep up blocks instead. A resumed session stays paused while an
+// acknowledging client is too far behind. The pause is lifted on its own
+// when every client that asked for it has detached or disconnected.
+// Answered with a FlowEvent.
+type PauseRequest struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// AckRequest tells the daemon how much of a session's output this client
+// has consumed: the Offset of the last DataEvent it has finished with.
+// Only counted for clients that attached with Ack set.
+type AckRequest struct {
+	Type   string `json:"type"`
+	ID     string `json:"id"`
+	Offset uint64 `json:"offset"`
+}
+
+// OutputRange selects part of a session's output by stream offset
+// (From up to To) and/or by when it was written (unix ms, Since up to
+// Until). Zero leaves that end open. Times are resolved against a coarse
+// index, so the range is rounded out to about a second either side.
+type OutputRange struct {
+	From  uint64 `json:"from,omitempty"`
+	To    uint64 `json:"to,omitempty"`
+	Since int64  `json:"since,omitempty"`
+	Until int64  `json:"until,omitempty"`
+}
+
+// OutputRequest fetches part of a session's scrollback.
+type OutputRequest struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+	OutputRange
+}
+
+// ExportRequest renders part of a session's output for sharing: as plain
+// text with escape sequences stripped ("text", the default) or as a
+// self-contained HTML page with colours kept ("html"). The result is
+// always returned inline; saving it is up to the client, so the daemon
+// never writes files on a client's behalf.
+type ExportRequest struct {
+	Type   string `json:"type"`
+	ID     string `json:"id"`
+	Format string `json:"format,omitempty"`
+	OutputRange
+}
+
+// TimesRequest asks when output at the given offsets was written, or for
+// the session's whole time index when there are none.
+type TimesRequest struct {
+	Type    string   `json:"type"`
+	ID      string   `json:"id"`
+	Offsets []uint64 `json:"offsets,omitempty"`
+}
+
+// ResizeRequest reports the size this client wants for a PTY. The daemon
+// arbitrates between clients and answers with a ResizedEvent.
 type ResizeRequest struct {
 	Type string `json:"type"`
 	ID   string `json:"id"`
@@ -31,22 +167,71 @@ type ResizeRequest struct {
 	Rows int    `json:"rows"`
 }
 
-// DestroyRequest kills a PTY session.
+// DestroyRequest kills a PTY session. A graceful destroy escalates
+// SIGHUP → SIGTERM → SIGKILL, waiting the given timeouts (defaults apply
+// when zero) between steps, and answers with a DestroyedResponse.
 type DestroyRequest struct {
+	Type          string `json:"type"`
+	ID            string `json:"id"`
+	Graceful      bool   `json:"graceful,omitempty"`
+	HupTimeoutMs  int    `json:"hupTimeoutMs,omitempty"`
+	TermTimeoutMs int    `json:"termTimeoutMs,omitempty"`
+	KillTimeoutMs int    `json:"killTimeoutMs,omitempty"`
+}
+
+// SignalRequest sends a signal ("SIGINT", "INT" or a number) to a session.
+// Target is "leader" (default), "foreground" (the PTY's foreground process
+// group), "tree" (the leader and all its descendants) or "pid" (the single
+// process Pid, which must belong to the session's tree).
+type SignalRequest struct {
+	Type   string `json:"type"`
+	ID     string `json:"id"`
+	Signal string `json:"signal"`
+	Target string `json:"target,omitempty"`
+	Pid    int    `json:"pid,omitempty"`
+}
+
+// PsRequest asks for the process tree under a session's leader.
+type PsRequest struct {
 	Type string `json:"type"`
 	ID   string `json:"id"`
 }
 
 // ListRequest asks for all sessions (alive and recently dead).
+// Selector narrows them by label, e.g. "project=web,!pinned"; see
+// parseSelector.
 type ListRequest struct {
-	Type string `json:"type"`
+	Type     string `json:"type"`
+	Selector string `json:"selector,omitempty"`
+}
+
+// UpdateRequest changes a session's name, labels or metadata. A nil Name
+// leaves it as is. Labels and Metadata are patches: keys with a null value
+// are removed, others are set, and keys not mentioned are kept.
+type UpdateRequest struct {
+	Type     string             `json:"type"`
+	ID       string             `json:"id"`
+	Name     *string            `json:"name,omitempty"`
+	Labels   map[string]*string `json:"labels,omitempty"`
+	Metadata map[string]*string `json:"metadata,omitempty"`
 }
 
 // AttachRequest subscribes the client to a session's output.
 // The response includes the ring buffer contents for replay.
+// Mode is "controller" (default) or "viewer"; viewers cannot write or resize.
 type AttachRequest struct {
 	Type string `json:"type"`
 	ID   string `json:"id"`
+	Mode string `json:"mode,omitempty"`
+	// Ack promises "ack" requests as output is consumed. The session is
+	// paused while this client is too far behind.
+	Ack bool `json:"ack,omitempty"`
+	// Replay is "full" (the default) for all the scrollback, or "screen"
+	// to start at the last full clear or alternate screen switch, which
+	// skips the redraws a busy TUI fills the ring with. History bounds
+	// how much output from before that point is kept (default 64KiB).
+	Replay  string `json:"replay,omitempty"`
+	History *int   `json:"history,omitempty"`
 }
 
 // DetachRequest unsubscribes the client from a session's output.
@@ -55,14 +240,76 @@ type DetachRequest struct {
 	ID   string `json:"id"`
 }
 
+// TakeControlRequest makes an attached client the session's controller.
+// The previous controller is demoted to viewer and notified.
+type TakeControlRequest struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// StatsRequest asks for live resource usage of one session, or all
+// sessions when ID is empty.
+type StatsRequest struct {
+	Type string `json:"type"`
+	ID   string `json:"id,omitempty"`
+}
+
+// ReloadRequest re-reads the config file, like sending the daemon SIGHUP.
+type ReloadRequest struct {
+	Type string `json:"type"`
+}
+
+// ArchivedRequest lists journaled sessions that aren't running,
+// optionally narrowed by a label selector as in ListRequest.
+type ArchivedRequest struct {
+	Type     string `json:"type"`
+	Selector string `json:"selector,omitempty"`
+}
+
+// ResurrectRequest respawns an archived session from its journal entry.
+// Cols and Rows override the journaled size when both are set.
+type ResurrectRequest struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+	Cols int    `json:"cols,omitempty"`
+	Rows int    `json:"rows,omitempty"`
+}
+
+// VersionRequest asks the daemon to identify itself.
+type VersionRequest struct {
+	Type string `json:"type"`
+}
+
 // --- Daemon → Client responses ---
 
 // CreatedResponse confirms a session was created.
-// The creator is auto-attached.
+// The creator is auto-attached. Enforcement says how resource limits are
+// applied: "cgroup", "rlimit" (no cgroup: per-process memory and, on Linux,
+// a process count only), "none" (requested but unenforced), or empty when the session
+// has neither limits nor a cgroup.
 type CreatedResponse struct {
+	Type        string `json:"type"`
+	ID          string `json:"id"`
+	Pid         int    `json:"pid"`
+	Enforcement string `json:"enforcement,omitempty"`
+}
+
+// DestroyedResponse reports how a graceful destroy ended: Step is the
+// signal the session exited after, or "exited" if it was already dead.
+type DestroyedResponse struct {
 	Type string `json:"type"`
 	ID   string `json:"id"`
-	Pid  int    `json:"pid"`
+	Step string `json:"step"`
+}
+
+// SignaledResponse confirms a signal was delivered. Pids lists the
+// processes signalled; a negative entry is a process group.
+type SignaledResponse struct {
+	Type   string `json:"type"`
+	ID     string `json:"id"`
+	Signal string `json:"signal"`
+	Target string `json:"target"`
+	Pids   []int  `json:"pids"`
 }
 
 // ErrorResponse reports an error for a request.
@@ -74,17 +321,50 @@ type ErrorResponse struct {
 
 // DataEvent delivers live PTY output to attached clients.
 type DataEvent struct {
-	Type string `json:"type"`
-	ID   string `json:"id"`
-	Data string `json:"data"`
+	Type   string `json:"type"`
+	ID     string `json:"id"`
+	Data   string `json:"data"`
+	Offset uint64 `json:"offset"` // output offset just past Data
+}
+
+// DrainedEvent tells attached clients that a backlog of queued input (more
+// than fits in one PTY write) has all been written. A write of a lone ^C,
+// ^\ or ^Z goes ahead of queued input and discards it, like a terminal
+// flushing its input on an interrupt; Dropped counts the bytes discarded.
+type DrainedEvent struct {
+	Type    string `json:"type"`
+	ID      string `json:"id"`
+	Dropped int    `json:"dropped,omitempty"`
+}
+
+// FlowEvent tells attached clients that a session's output was paused or
+// resumed, by request or because a client fell behind.
+type FlowEvent struct {
+	Type   string `json:"type"`
+	ID     string `json:"id"`
+	Paused bool   `json:"paused"`
 }
 
 // ExitEvent reports that a PTY session's child process exited.
+// ExitCode is -1 when the process was killed by a signal; see Signal.
 type ExitEvent struct {
 	Type     string `json:"type"`
 	ID       string `json:"id"`
 	ExitCode int    `json:"exitCode"`
 	Pid      int    `json:"pid"`
+	ExitDetail
+}
+
+// ExitDetail describes how a session's process ended, from its wait status
+// and resource usage. CPU times and MaxRSSBytes cover the leader and any
+// children it waited for.
+type ExitDetail struct {
+	Signal      string `json:"signal,omitempty"` // e.g. "SIGKILL"; empty on normal exit
+	CoreDumped  bool   `json:"coreDumped,omitempty"`
+	RuntimeMs   int64  `json:"runtimeMs"`
+	UserCPUMs   int64  `json:"userCpuMs"`
+	SysCPUMs    int64  `json:"sysCpuMs"`
+	MaxRSSBytes int64  `json:"maxRssBytes"`
 }
 
 // ListResponse returns all known sessions.
@@ -101,11 +381,327 @@ type SessionInfo struct {
 	Rows     int    `json:"rows"`
 	Alive    bool   `json:"alive"`
 	ExitCode int    `json:"exitCode"`
+	// Controller is the ID of the client allowed to send input, if any.
+	Controller   string `json:"controller,omitempty"`
+	ResizePolicy string `json:"resizePolicy"`
+	StartedAt    int64  `json:"startedAt"` // unix ms
+	Enforcement  string `json:"enforcement,omitempty"`
+	// Ports the session's processes are listening on, as of the last scan.
+	Ports    []ListenPort      `json:"ports,omitempty"`
+	Name     string            `json:"name,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Modes lists the DECSET private modes the application has turned on,
+	// e.g. 1 (application cursor keys) or 2004 (bracketed paste).
+	Modes []int `json:"modes"`
+	// Paused is set while the daemon has stopped reading the session's
+	// output (see PauseRequest).
+	Paused bool `json:"paused,omitempty"`
+	// Set once the session has exited.
+	*ExitDetail
+}
+
+// ListenPort is a TCP port a session's process is listening on. Addr is
+// the bound address ("0.0.0.0" or "::" for all interfaces).
+type ListenPort struct {
+	Port int    `json:"port"`
+	Addr string `json:"addr"`
+	Pid  int    `json:"pid"`
+}
+
+// PortEvent reports that a session started (Listening) or stopped
+// listening on a TCP port.
+type PortEvent struct {
+	Type      string `json:"type"`
+	ID        string `json:"id"`
+	Listening bool   `json:"listening"`
+	ListenPort
 }
 
 // AttachedResponse confirms attachment and provides ring buffer contents.
+// Mode is the mode actually granted: asking to control a session that
+// another client controls yields "viewer".
 type AttachedResponse struct {
 	Type       string `json:"type"`
 	ID         string `json:"id"`
 	Scrollback string `json:"scrollback"`
+	Offset     uint64 `json:"offset"` // output offset just past Scrollback
+	// Encoding is "gzip" if Scrollback (or each chunk) is gzip, base64
+	// encoded. Chunks, if non-zero, is how many ReplayEvents follow in
+	// place of Scrollback.
+	Encoding   string `json:"encoding,omitempty"`
+	Chunks     int    `json:"chunks,omitempty"`
+	Mode       string `json:"mode"`
+	Controller string `json:"controller,omitempty"`
+	Client     string `json:"client"`
+}
+
+// ReplayEvent carries one chunk of an attach replay, encoded as the
+// AttachedResponse said. Chunks arrive in order, but live DataEvents for
+// the session may arrive among them: those past the AttachedResponse's
+// Offset follow the replay.
+type ReplayEvent struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+	Seq  int    `json:"seq"`
+	Data string `json:"data"`
+	Last bool   `json:"last,omitempty"`
+}
+
+// OutputResponse carries the output in a range. From and To are the
+// offsets it covers, Since and Until roughly when that was written (0 if
+// unknown). Data starts at a clean point with its colours restored.
+type OutputResponse struct {
+	Type  string `json:"type"`
+	ID    string `json:"id"`
+	From  uint64 `json:"from"`
+	To    uint64 `json:"to"`
+	Since int64  `json:"since"`
+	Until int64  `json:"until"`
+	Data  string `json:"data"`
+}
+
+// ExportResponse reports an export: the range it covers (as in
+// OutputResponse), its size in bytes, and the rendered Data.
+type ExportResponse struct {
+	Type   string `json:"type"`
+	ID     string `json:"id"`
+	Format string `json:"format"`
+	From   uint64 `json:"from"`
+	To     uint64 `json:"to"`
+	Since  int64  `json:"since"`
+	Until  int64  `json:"until"`
+	Size   int    `json:"size"`
+	Data   string `json:"data"`
+}
+
+// TimeMark says output from Offset on was written at At (unix ms), until
+// the next mark.
+type TimeMark struct {
+	Offset uint64 `json:"offset"`
+	At     int64  `json:"at"`
+}
+
+// TimesResponse answers a TimesRequest: a time per requested offset (0 for
+// output older than the index), or the index itself.
+type TimesResponse struct {
+	Type  string     `json:"type"`
+	ID    string     `json:"id"`
+	Times []int64    `json:"times,omitempty"`
+	Index []TimeMark `json:"index,omitempty"`
+}
+
+// HelloResponse confirms what the daemon will do for this connection.
+type HelloResponse struct {
+	Type        string `json:"type"`
+	Client      string `json:"client"`
+	Version     string `json:"version"`
+	Compression string `json:"compression"` // "none" or the chosen encoding
+	ChunkSize   int    `json:"chunkSize,omitempty"`
+}
+
+// ControlEvent tells each attached client that a session's controller
+// changed. Mode is the recipient's own mode after the change.
+type ControlEvent struct {
+	Type       string `json:"type"`
+	ID         string `json:"id"`
+	Controller string `json:"controller"`
+	Previous   string `json:"previous,omitempty"`
+	Mode       string `json:"mode"`
+}
+
+// ResizedEvent reports a session's effective PTY size. It goes to every
+// attached client when the size changes, and to a client whose resize
+// request didn't change it.
+type ResizedEvent struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+	Cols int    `json:"cols"`
+	Rows int    `json:"rows"`
+}
+
+// StatsResponse reports live resource usage per session and, when all
+// sessions were asked for, the daemon's own counters.
+type StatsResponse struct {
+	Type     string         `json:"type"`
+	Sessions []SessionStats `json:"sessions"`
+	Daemon   *DaemonStats   `json:"daemon,omitempty"`
+}
+
+// DaemonStats is the daemon's health: session counts, clients and their
+// socket send queues, ring memory, broadcast latency and sweeper activity.
+type DaemonStats struct {
+	Pid             int           `json:"pid"`
+	UptimeSec       int64         `json:"uptimeSec"`
+	Goroutines      int           `json:"goroutines"`
+	SessionsAlive   int           `json:"sessionsAlive"`
+	SessionsDead    int           `json:"sessionsDead"`
+	SessionsCreated uint64        `json:"sessionsCreated"`
+	SessionsExited  uint64        `json:"sessionsExited"`
+	Clients         []ClientStats `json:"clients"`
+	RingAllocated   int64         `json:"ringAllocatedBytes"`
+	RingUsed        int64         `json:"ringUsedBytes"`
+	Broadcast       LatencyStats  `json:"broadcast"`
+	OutputBatches   uint64        `json:"outputBatches"`
+	Sweeps          uint64        `json:"sweeps"`
+	SweptSessions   uint64        `json:"sweptSessions"`
+	LastSweep       int64         `json:"lastSweep"` // unix ms, 0 if never
+}
+
+// ClientStats describes one connected client. QueuedBytes is output the
+// daemon has written that the client hasn't read yet.
+type ClientStats struct {
+	ID          string `json:"id"`
+	Attached    int    `json:"attached"`
+	Controls    int    `json:"controls"`
+	Sent        uint64 `json:"sent"` // messages
+	QueuedBytes int    `json:"queuedBytes"`
+}
+
+// LatencyStats summarises a latency histogram in microseconds.
+type LatencyStats struct {
+	Count uint64 `json:"count"`
+	AvgUs int64  `json:"avgUs"`
+	P99Us int64  `json:"p99Us"`
+	MaxUs int64  `json:"maxUs"`
+}
+
+// SessionStats is one session's resource usage. Source is "cgroup" when
+// read from the session's cgroup, or "tree" when summed over its process
+// tree (which misses processes that escaped it).
+type SessionStats struct {
+	ID          string         `json:"id"`
+	Alive       bool           `json:"alive"`
+	Source      string         `json:"source"`
+	CPUMs       int64          `json:"cpuMs"`
+	MemoryBytes int64          `json:"memoryBytes"`
+	Processes   int            `json:"processes"`
+	Limits      *SessionLimits `json:"limits,omitempty"`
+	Enforcement string         `json:"enforcement,omitempty"`
+	BytesIn     uint64         `json:"bytesIn"`  // written to the PTY
+	BytesOut    uint64         `json:"bytesOut"` // read from the PTY
+	RingUsed    int            `json:"ringUsedBytes"`
+	// InputPending is input queued but not yet written to the PTY.
+	InputPending int `json:"inputPendingBytes"`
+}
+
+// PsResponse lists a session's process tree depth-first, so each process
+// follows its parent. ForegroundPgid is the PTY's foreground process group
+// (0 if unknown).
+type PsResponse struct {
+	Type           string        `json:"type"`
+	ID             string        `json:"id"`
+	ForegroundPgid int           `json:"foregroundPgid"`
+	Processes      []ProcessInfo `json:"processes"`
+}
+
+// ProcessInfo describes one process in a session's tree. Depth is 0 for
+// the session leader.
+type ProcessInfo struct {
+	Pid        int      `json:"pid"`
+	Ppid       int      `json:"ppid"`
+	Pgid       int      `json:"pgid"`
+	Depth      int      `json:"depth"`
+	State      string   `json:"state"`
+	Command    []string `json:"command"`
+	Cwd        string   `json:"cwd,omitempty"`
+	CPUMs      int64    `json:"cpuMs"`
+	RSSBytes   int64    `json:"rssBytes"`
+	Foreground bool     `json:"foreground"`
+}
+
+// ReloadedResponse confirms a config reload. RestartRequired lists changed
+// settings that only take effect after a daemon restart.
+type ReloadedResponse struct {
+	Type            string   `json:"type"`
+	RestartRequired []string `json:"restartRequired"`
+}
+
+// VersionResponse identifies the running daemon.
+type VersionResponse struct {
+	Type      string `json:"type"`
+	Version   string `json:"version"`
+	Pid       int    `json:"pid"`
+	StartedAt int64  `json:"startedAt"` // unix ms
+	Sessions  int    `json:"sessions"`
+}
+
+// ArchivedResponse lists sessions that can be resurrected, newest first.
+type ArchivedResponse struct {
+	Type     string            `json:"type"`
+	Sessions []ArchivedSession `json:"sessions"`
+}
+
+// ArchivedSession describes a journaled session that isn't running.
+// Reason is "exited", "stopped" (by a daemon shutdown) or "lost" (the
+// daemon died without recording an exit, e.g. on a crash or power loss).
+type ArchivedSession struct {
+	ID              string            `json:"id"`
+	Command         string            `json:"command"`
+	Args            []string          `json:"args"`
+	Cwd             string            `json:"cwd"`
+	LastCwd         string            `json:"lastCwd,omitempty"`
+	Name            string            `json:"name,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+	Reason          string            `json:"reason"`
+	CreatedAt       int64             `json:"createdAt"` // unix ms
+	EndedAt         int64             `json:"endedAt"`   // unix ms; for "lost", the last checkpoint
+	ExitCode        int               `json:"exitCode"`
+	ScrollbackBytes int64             `json:"scrollbackBytes"`
+	Restored        int               `json:"restored,omitempty"`
+}
+
+// ResurrectedResponse confirms an archived session is running again.
+// Attach to see its restored scrollback.
+type ResurrectedResponse struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+	Pid  int    `json:"pid"`
+	Cwd  string `json:"cwd"`
+}
+
+// UpdatedEvent carries a session's name, labels and metadata after an
+// update. It answers the update and is sent to every attached client.
+type UpdatedEvent struct {
+	Type     string            `json:"type"`
+	ID       string            `json:"id"`
+	Name     string            `json:"name,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// SentResponse confirms keys or a paste were queued for the session.
+type SentResponse struct {
+	Type      string `json:"type"`
+	ID        string `json:"id"`
+	Bytes     int    `json:"bytes"`
+	Bracketed bool   `json:"bracketed,omitempty"`
+}
+
+// WroteManyResponse reports the outcome of a writeMany for each target.
+type WroteManyResponse struct {
+	Type    string        `json:"type"`
+	Results []WriteResult `json:"results"`
+}
+
+// WriteResult is one session's outcome in a writeMany.
+type WriteResult struct {
+	ID    string `json:"id"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// GroupResponse gives a group's members after a change; none means the
+// group was deleted.
+type GroupResponse struct {
+	Type string   `json:"type"`
+	Name string   `json:"name"`
+	IDs  []string `json:"ids"`
+}
+
+// GroupsResponse lists every session group by name.
+type GroupsResponse struct {
+	Type   string              `json:"type"`
+	Groups map[string][]string `json:"groups"`
 }
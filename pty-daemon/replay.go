@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// Bounds on the replay chunk size a client may ask for.
+const (
+	minReplayChunk = 4 * 1024
+	maxReplayChunk = 1024 * 1024
+)
+
+// replayCompressions are the encodings the daemon can send a replay in,
+// besides plain text. zstd isn't among them: it isn't in the standard
+// library, and gzip gets most of the benefit on terminal output.
+var replayCompressions = []string{"gzip"}
+
+// replayOptions say how a client wants attach replays sent. The zero
+// value is the original behaviour: scrollback inline, uncompressed.
+type replayOptions struct {
+	compression string // "" or one of replayCompressions
+	chunkSize   int    // 0: inline in AttachedResponse
+}
+
+// negotiateReplay picks the first compression the client offers that the
+// daemon supports, and checks the chunk size.
+func negotiateReplay(req HelloRequest) (replayOptions, error) {
+	var opts replayOptions
+	for _, c := range req.Compression {
+		if c == "none" {
+			break
+		}
+		if slices.Contains(replayCompressions, c) {
+			opts.compression = c
+			break
+		}
+	}
+	if req.ChunkSize != 0 && (req.ChunkSize < minReplayChunk || req.ChunkSize > maxReplayChunk) {
+		return opts, fmt.Errorf("chunkSize must be between %d and %d", minReplayChunk, maxReplayChunk)
+	}
+	opts.chunkSize = req.ChunkSize
+	return opts, nil
+}
+
+// encodeReplay renders replay data for a JSON string: as is, or
+// compressed and base64-encoded.
+func encodeReplay(data []byte, compression string) (string, error) {
+	if compression == "" {
+		return string(data), nil
+	}
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	if _, err := zw.Write(data); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b.Bytes()), nil
+}
+
+// replayChunks splits data into pieces of at most size bytes, never
+// inside a UTF-8 sequence, so each piece is valid on its own. There is
+// always at least one, so a client waiting for the last chunk gets it.
+func replayChunks(data []byte, size int) [][]byte {
+	var out [][]byte
+	for len(data) > size {
+		n := size - incompleteUTF8Tail(data[:size])
+		out = append(out, data[:n])
+		data = data[n:]
+	}
+	if len(data) > 0 || len(out) == 0 {
+		out = append(out, data)
+	}
+	return out
+}
+
+// sendAttached sends an attach reply with its replay, the way the client
+// negotiated: inline in resp, or as ReplayEvents straight after it.
+func (c *Client) sendAttached(resp AttachedResponse, scrollback []byte) error {
+	opts := c.replay
+	resp.Encoding = opts.compression
+	if opts.chunkSize == 0 {
+		data, err := encodeReplay(scrollback, opts.compression)
+		if err != nil {
+			return err
+		}
+		resp.Scrollback = data
+		c.Send(resp)
+		return nil
+	}
+
+	chunks := replayChunks(scrollback, opts.chunkSize)
+	events := make([]ReplayEvent, len(chunks))
+	for i, chunk := range chunks {
+		data, err := encodeReplay(chunk, opts.compression)
+		if err != nil {
+			return err
+		}
+		events[i] = ReplayEvent{Type: "replay", ID: resp.ID, Seq: i, Data: data, Last: i == len(chunks)-1}
+	}
+	resp.Chunks = len(events)
+	c.Send(resp)
+	for _, ev := range events {
+		c.Send(ev)
+	}
+	return nil
+}
+
+// defaultReplayHistory is how much output from before the last clear a
+// trimmed replay keeps, when the client doesn't say.
+const defaultReplayHistory = 64 * 1024
+
+// trimReplay cuts scrollback down to what a fresh terminal needs to show
+// the current screen: everything since the last full clear, or since the
+// alternate screen was entered (and last cleared), plus up to history
+// bytes of normal-screen output from before that for the terminal's own
+// scrollback. Where output is skipped, modes is replayed to restore what
+// it changed, and each piece starts with the SGR state in effect there.
+func trimReplay(snap ringSnapshot, marks screenMarks, modes []byte, history int) []byte {
+	start, end := snap.start, snap.end()
+	cut := marks.Clear
+	if marks.InAlt {
+		cut = marks.Alt
+	}
+	keep := start
+	if cut > start+uint64(history) {
+		keep = cut - uint64(history)
+	}
+	altTrimmed := marks.InAlt && (marks.AltClear > marks.Alt || marks.Alt < start)
+	if keep == start && !altTrimmed {
+		return snap.span(start, end, false)
+	}
+
+	out := snap.span(keep, cut, false)
+	out = append(out, modes...)
+	switch {
+	case !marks.InAlt:
+		out = append(out, snap.span(cut, end, true)...)
+	case altTrimmed:
+		out = append(out, "\x1b[?"+strconv.Itoa(marks.AltMode)+"h"...)
+		out = append(out, snap.span(marks.AltClear, end, true)...)
+	default:
+		out = append(out, snap.span(marks.Alt, end, true)...)
+	}
+	return out
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestNegotiateReplay(t *testing.T) {
+	cases := []struct {
+		offer []string
+		want  string
+	}{
+		{[]string{"zstd", "gzip"}, "gzip"},
+		{[]string{"none", "gzip"}, ""},
+		{[]string{"zstd"}, ""},
+		{nil, ""},
+	}
+	for _, c := range cases {
+		opts, err := negotiateReplay(HelloRequest{Compression: c.offer})
+		if err != nil || opts.compression != c.want {
+			t.Errorf("offer %v: got %q, %v; want %q", c.offer, opts.compression, err, c.want)
+		}
+	}
+	if _, err := negotiateReplay(HelloRequest{ChunkSize: 100}); err == nil {
+		t.Error("expected a tiny chunk size to be refused")
+	}
+}
+
+func TestEncodeReplay_Gzip(t *testing.T) {
+	data := []byte(strings.Repeat("\x1b[32mhello\x1b[0m world\r\n", 1000))
+	enc, err := encodeReplay(data, "gzip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := base64.StdEncoding.DecodeString(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raw) >= len(data)/10 {
+		t.Errorf("expected repetitive output to compress well: %d → %d bytes", len(data), len(raw))
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := io.ReadAll(zr)
+	if err != nil || !bytes.Equal(back, data) {
+		t.Fatalf("round trip failed: %v", err)
+	}
+}
+
+func TestReplayChunks_KeepsUTF8Whole(t *testing.T) {
+	data := []byte(strings.Repeat("ab─", 5000)) // 3-byte box-drawing chars
+	chunks := replayChunks(data, 4096)
+	var joined []byte
+	for i, c := range chunks {
+		if len(c) > 4096 {
+			t.Fatalf("chunk %d is %d bytes", i, len(c))
+		}
+		if !utf8.Valid(c) {
+			t.Fatalf("chunk %d splits a character", i)
+		}
+		joined = append(joined, c...)
+	}
+	if !bytes.Equal(joined, data) {
+		t.Fatal("chunks don't add up to the data")
+	}
+	if got := replayChunks(nil, 4096); len(got) != 1 || len(got[0]) != 0 {
+		t.Fatalf("expected one empty chunk for no scrollback, got %d", len(got))
+	}
+}
+
+// snapshotOf makes a snapshot of data ending at stream offset end.
+func snapshotOf(data []byte, end uint64) ringSnapshot {
+	return ringSnapshot{data: data, start: end - uint64(len(data))}
+}
+
+func TestTrimReplay(t *testing.T) {
+	history := "$ make\r\n" + strings.Repeat("building...\r\n", 100)
+	clearSeq := "\x1b[H\x1b[2J"
+	screen := "$ top\r\n"
+
+	m := newModeTracker()
+	data := []byte(history + clearSeq + screen)
+	m.feed(data)
+	marks, modes := m.screen()
+	got := string(trimReplay(snapshotOf(data, uint64(len(data))), marks, modes, 20))
+	if want := history[len(history)-20:] + "\x1b[0m" + clearSeq + screen; got != want {
+		t.Fatalf("normal screen: got %q, want %q", got, want)
+	}
+
+	// A TUI that redrew the alternate screen many times, in colour.
+	tui := "\x1b[?1049h\x1b[?1h\x1b[44m" + strings.Repeat("\x1b[2Jframe", 50)
+	data = append(data, tui...)
+	m.feed([]byte(tui))
+	marks, modes = m.screen()
+	got = string(trimReplay(snapshotOf(data, uint64(len(data))), marks, modes, 0))
+	if want := "\x1b[?1h\x1b[?1049h\x1b[0;44m\x1b[2Jframe"; got != want {
+		t.Fatalf("alt screen: got %q, want %q", got, want)
+	}
+
+	// Offsets are the stream's, not the ring's: here the ring has wrapped
+	// past the alt screen switch, which the replay puts back.
+	tail := data[len(data)-100:]
+	got = string(trimReplay(snapshotOf(tail, uint64(len(data))), marks, modes, 0))
+	if !strings.HasPrefix(got, "\x1b[?1h\x1b[?1049h\x1b[0m\x1b[2Jframe") || strings.Count(got, "frame") != 1 {
+		t.Fatalf("wrapped alt screen: got %q", got)
+	}
+
+	// Nothing to cut: the data comes back as is.
+	plain := []byte("no clears here")
+	if got := trimReplay(snapshotOf(plain, 1000), screenMarks{}, nil, 0); string(got) != string(plain) {
+		t.Fatalf("expected untrimmed output, got %q", got)
+	}
+}
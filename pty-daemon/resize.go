@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// resizePolicy decides the PTY size when several clients want different ones.
+type resizePolicy string
+
+const (
+	// policySmallest fits every client: the minimum of each dimension.
+	policySmallest resizePolicy = "smallest"
+	// policyLargest uses the maximum of each dimension.
+	policyLargest resizePolicy = "largest"
+	// policyController uses the controller's size, falling back to the
+	// latest of the clients that aren't viewers.
+	policyController resizePolicy = "controller"
+	// policyLatest uses the size of the most recently active client.
+	policyLatest resizePolicy = "latest"
+)
+
+// defaultResizePolicy matches input ownership: whoever types decides the size.
+const defaultResizePolicy = policyController
+
+// parseResizePolicy maps the wire value to a policy. Empty means default.
+func parseResizePolicy(s string) (resizePolicy, error) {
+	switch p := resizePolicy(s); p {
+	case "":
+		return defaultResizePolicy, nil
+	case policySmallest, policyLargest, policyController, policyLatest:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown resize policy: %s", s)
+}
+
+// ptySize is a terminal size in character cells.
+type ptySize struct {
+	Cols int
+	Rows int
+}
+
+// sizeRequest is one client's desired PTY size. Active is bumped by resizes
+// and input, and orders clients for policyLatest. Viewer marks a client
+// attached as a viewer, whose size policyController ignores.
+type sizeRequest struct {
+	Cols   int
+	Rows   int
+	Active time.Time
+	Viewer bool
+}
+
+// arbitrateSize picks the effective size from the clients' requests.
+// ok is false when no client has asked for a size.
+func arbitrateSize(policy resizePolicy, reqs map[string]sizeRequest, controller string) (cols, rows int, ok bool) {
+	if len(reqs) == 0 {
+		return 0, 0, false
+	}
+	switch policy {
+	case policySmallest, policyLargest:
+		first := true
+		for _, r := range reqs {
+			switch {
+			case first:
+				cols, rows, first = r.Cols, r.Rows, false
+			case policy == policySmallest:
+				cols, rows = min(cols, r.Cols), min(rows, r.Rows)
+			default:
+				cols, rows = max(cols, r.Cols), max(rows, r.Rows)
+			}
+		}
+		return cols, rows, true
+	case policyController:
+		if r, found := reqs[controller]; found {
+			return r.Cols, r.Rows, true
+		}
+		// A viewer only watches, so it mustn't size the session for the
+		// clients typing into it.
+		others := make(map[string]sizeRequest, len(reqs))
+		for id, r := range reqs {
+			if !r.Viewer {
+				others[id] = r
+			}
+		}
+		if len(others) == 0 {
+			return 0, 0, false
+		}
+		reqs = others
+	}
+	var latest sizeRequest
+	for _, r := range reqs {
+		if !ok || r.Active.After(latest.Active) {
+			latest, ok = r, true
+		}
+	}
+	return latest.Cols, latest.Rows, true
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestArbitrateSize(t *testing.T) {
+	t0 := time.Unix(1000, 0)
+	reqs := map[string]sizeRequest{
+		"a": {Cols: 120, Rows: 30, Active: t0},
+		"b": {Cols: 80, Rows: 50, Active: t0.Add(time.Second)},
+	}
+	cases := []struct {
+		policy     resizePolicy
+		controller string
+		cols, rows int
+	}{
+		{policySmallest, "", 80, 30},
+		{policyLargest, "", 120, 50},
+		{policyController, "a", 120, 30},
+		{policyController, "", 80, 50}, // no controller: falls back to latest
+		{policyLatest, "a", 80, 50},
+	}
+	for _, tc := range cases {
+		cols, rows, ok := arbitrateSize(tc.policy, reqs, tc.controller)
+		if !ok || cols != tc.cols || rows != tc.rows {
+			t.Errorf("%s/%q: expected %dx%d, got %dx%d (ok=%v)", tc.policy, tc.controller, tc.cols, tc.rows, cols, rows, ok)
+		}
+	}
+}
+
+func TestArbitrateSize_ControllerPolicyIgnoresViewers(t *testing.T) {
+	t0 := time.Unix(1000, 0)
+	reqs := map[string]sizeRequest{
+		"a": {Cols: 120, Rows: 30, Active: t0},
+		"v": {Cols: 40, Rows: 10, Active: t0.Add(time.Second), Viewer: true},
+	}
+	if cols, rows, ok := arbitrateSize(policyController, reqs, ""); !ok || cols != 120 || rows != 30 {
+		t.Fatalf("expected the non-viewer's 120x30, got %dx%d (ok=%v)", cols, rows, ok)
+	}
+	delete(reqs, "a")
+	if _, _, ok := arbitrateSize(policyController, reqs, ""); ok {
+		t.Fatal("expected a viewer alone not to size the session")
+	}
+	if cols, _, ok := arbitrateSize(policySmallest, reqs, ""); !ok || cols != 40 {
+		t.Fatal("expected viewers to count under the smallest policy")
+	}
+}
+
+func TestArbitrateSize_NoRequests(t *testing.T) {
+	if _, _, ok := arbitrateSize(policySmallest, nil, ""); ok {
+		t.Fatal("expected no size without requests")
+	}
+}
+
+func TestParseResizePolicy(t *testing.T) {
+	if p, err := parseResizePolicy(""); err != nil || p != defaultResizePolicy {
+		t.Fatalf("empty policy: got %q, %v", p, err)
+	}
+	if _, err := parseResizePolicy("biggest"); err == nil {
+		t.Fatal("expected error for unknown policy")
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"sync"
+	"time"
 )
 
 // incompleteUTF8Tail returns the number of trailing bytes that form an
@@ -41,17 +42,6 @@ func incompleteUTF8Tail(data []byte) int {
 	return 0
 }
 
-// skipLeadingContinuationBytes skips orphaned UTF-8 continuation bytes
-// (10xxxxxx) at the start of data. These occur when a ring buffer wrap
-// overwrites the start byte of a multi-byte character.
-func skipLeadingContinuationBytes(data []byte) []byte {
-	i := 0
-	for i < len(data) && i < 4 && data[i]&0xC0 == 0x80 {
-		i++
-	}
-	return data[i:]
-}
-
 // DefaultRingSize is 1MB, matching the server's ScrollbackBuffer max.
 const DefaultRingSize = 1024 * 1024
 
@@ -63,6 +53,16 @@ type RingBuffer struct {
 	size int
 	pos  int  // next write position
 	full bool // buffer has wrapped at least once
+
+	// total counts every byte ever written: the stream offset of the
+	// next byte, which clients use to say how much output they've seen.
+	total uint64
+
+	// evicted has been fed every byte overwritten, so it is the parser
+	// state the oldest byte held was written in.
+	evicted ansiState
+
+	times []TimeMark // when the output held was written (see stamp)
 }
 
 func NewRingBuffer(size int) *RingBuffer {
@@ -71,10 +71,24 @@ func NewRingBuffer(size int) *RingBuffer {
 
 // Write appends data to the ring buffer.
 func (r *RingBuffer) Write(data []byte) {
+	r.writeAt(data, time.Now())
+}
+
+// writeAt appends data written at now.
+func (r *RingBuffer) writeAt(data []byte, now time.Time) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	if len(data) > 0 {
+		r.stamp(r.total, now)
+	}
+	r.total += uint64(len(data))
 	for len(data) > 0 {
+		if r.full {
+			for _, b := range r.buf[r.pos:min(r.pos+len(data), r.size)] {
+				r.evicted.feed(b)
+			}
+		}
 		n := copy(r.buf[r.pos:], data)
 		data = data[n:]
 		r.pos += n
@@ -83,26 +97,111 @@ func (r *RingBuffer) Write(data []byte) {
 			r.full = true
 		}
 	}
+	r.pruneTimes()
+}
+
+// Len returns the number of bytes currently held.
+func (r *RingBuffer) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.full {
+		return r.size
+	}
+	return r.pos
+}
+
+// Offset returns the stream offset just past the newest byte.
+func (r *RingBuffer) Offset() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.total
+}
+
+// Since returns a copy of the output from stream offset from on, as
+// written, or false if some of it has already been overwritten.
+func (r *RingBuffer) Since(from uint64) ([]byte, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	held := uint64(r.pos)
+	if r.full {
+		held = uint64(r.size)
+	}
+	if from > r.total || r.total-from > held {
+		return nil, false
+	}
+	n := int(r.total - from)
+	out := make([]byte, n)
+	// The newest n bytes end just before pos, wrapping backwards.
+	if k := min(n, r.pos); k > 0 {
+		copy(out[n-k:], r.buf[r.pos-k:r.pos])
+		n -= k
+	}
+	copy(out[:n], r.buf[r.size-n:])
+	return out, true
 }
 
+// Cap returns the buffer's allocated size.
+func (r *RingBuffer) Cap() int { return r.size }
+
 // Contents returns the ring buffer contents in order (oldest first).
-// If the buffer has wrapped, leading orphaned UTF-8 continuation bytes
-// are skipped so the output starts on a valid character boundary.
-// Returns a new slice that the caller owns.
+// If the buffer has wrapped, the oldest data can start partway through a
+// UTF-8 character or an escape sequence; that is skipped, so the output
+// starts at a clean point, and is preceded by the SGR sequence for the
+// colours and attributes in effect there. Returns a new slice that the
+// caller owns.
 func (r *RingBuffer) Contents() []byte {
+	snap := r.Snapshot()
+	return snap.span(snap.start, snap.end(), false)
+}
+
+// ringSnapshot is a copy of a ring's contents that output can be cut from
+// at any offset without splitting a character or escape sequence.
+type ringSnapshot struct {
+	data  []byte    // every byte held, oldest first
+	start uint64    // stream offset of data[0]
+	state ansiState // parser state data[0] was written in
+}
+
+// Snapshot copies the ring's contents.
+func (r *RingBuffer) Snapshot() ringSnapshot {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	snap := ringSnapshot{state: r.evicted.clone()}
 	if !r.full {
-		out := make([]byte, r.pos)
-		copy(out, r.buf[:r.pos])
-		return out
+		snap.data = make([]byte, r.pos)
+		copy(snap.data, r.buf[:r.pos])
+	} else {
+		// Buffer has wrapped: [pos..size) is oldest, [0..pos) is newest.
+		snap.data = make([]byte, r.size)
+		n := copy(snap.data, r.buf[r.pos:])
+		copy(snap.data[n:], r.buf[:r.pos])
+	}
+	snap.start = r.total - uint64(len(snap.data))
+	return snap
+}
+
+// end is the stream offset just past the snapshot.
+func (s ringSnapshot) end() uint64 { return s.start + uint64(len(s.data)) }
+
+// span returns the output between two stream offsets, starting at the
+// first clean point at or after from, led by the SGR sequence in effect
+// there. With reset, that sequence is sent even for the default state,
+// for output spliced onto other output whose attributes would carry over.
+func (s ringSnapshot) span(from, to uint64, reset bool) []byte {
+	from, to = max(from, s.start), min(to, s.end())
+	a := s.state.clone()
+	i := 0
+	for ; s.start+uint64(i) < from || i < len(s.data) && !a.clean(s.data[i]); i++ {
+		a.feed(s.data[i])
+	}
+	j := int(to - s.start)
+	if i >= j {
+		return nil
+	}
+	out := a.sgr.sequence()
+	if out == nil && reset {
+		out = []byte("\x1b[0m")
 	}
-	// Buffer has wrapped: [pos..size) is oldest, [0..pos) is newest.
-	// The wrap point may have split a multi-byte UTF-8 character, so
-	// the oldest data can start with orphaned continuation bytes.
-	out := make([]byte, r.size)
-	n := copy(out, r.buf[r.pos:])
-	copy(out[n:], r.buf[:r.pos])
-	return skipLeadingContinuationBytes(out)
+	return append(out, s.data[i:j]...)
 }
@@ -65,6 +65,59 @@ func TestRingBuffer_IncrementalWrites(t *testing.T) {
 	}
 }
 
+func TestRingBuffer_OffsetCountsEveryByte(t *testing.T) {
+	r := NewRingBuffer(4)
+	r.Write([]byte("abcdef"))
+	r.Write([]byte("gh"))
+	snap := r.Snapshot()
+	if string(snap.data) != "efgh" || snap.start != 4 || snap.end() != 8 || r.Offset() != 8 {
+		t.Fatalf("expected 'efgh' at offsets 4–8, got %q at %d–%d", snap.data, snap.start, snap.end())
+	}
+}
+
+func TestRingBuffer_SinceReturnsNewerOutput(t *testing.T) {
+	r := NewRingBuffer(4)
+	r.Write([]byte("ab"))
+	if got, ok := r.Since(1); !ok || string(got) != "b" {
+		t.Fatalf("expected 'b', got %q %v", got, ok)
+	}
+	r.Write([]byte("cdef"))
+	if got, ok := r.Since(3); !ok || string(got) != "def" {
+		t.Fatalf("expected 'def' across the wrap, got %q %v", got, ok)
+	}
+	if got, ok := r.Since(6); !ok || len(got) != 0 {
+		t.Fatalf("expected nothing new, got %q %v", got, ok)
+	}
+	if _, ok := r.Since(1); ok {
+		t.Fatal("expected overwritten output to be reported")
+	}
+}
+
+func TestRingBuffer_WrapSkipsPartialEscapes(t *testing.T) {
+	cases := []struct {
+		name, write, want string
+	}{
+		// The wrap lands inside "\x1b[1;31m": the rest of it is skipped,
+		// and the bold red it set is put back.
+		{"csi", "xx\x1b[1;31mred text", "\x1b[0;1;31mred text"},
+		// Inside an OSC title: skipped up to its BEL.
+		{"osc", "xx\x1b]0;a long window title\x07prompt$ ", "prompt$ "},
+		// Inside a DCS, which ends with ST (ESC \\).
+		{"dcs", "xx\x1bPq#0;2;0;0;0#0~~@@\x1b\\after", "after"},
+		// Colours set earlier, in bytes long gone, still apply.
+		{"carried", "\x1b[38;5;208m\x1b[4mabcdefghijklmnopqrstuvwxyz", "\x1b[0;4;38;5;208mqrstuvwxyz"},
+		// A reset in the evicted bytes drops what came before it.
+		{"reset", "\x1b[31mold\x1b[0mabcdefghijklmnop", "ghijklmnop"},
+	}
+	for _, c := range cases {
+		r := NewRingBuffer(10)
+		r.Write([]byte(c.write))
+		if got := string(r.Contents()); got != c.want {
+			t.Errorf("%s: expected %q, got %q", c.name, c.want, got)
+		}
+	}
+}
+
 // ── UTF-8 helper tests ──────────────────────────────────────────────
 
 func TestIncompleteUTF8Tail_ASCII(t *testing.T) {
@@ -128,23 +181,6 @@ func TestIncompleteUTF8Tail_Incomplete4Byte(t *testing.T) {
 	}
 }
 
-func TestSkipLeadingContinuationBytes(t *testing.T) {
-	// 94 80 are orphaned continuations from a split ─ (E2 94 80)
-	data := []byte{0x94, 0x80, 'h', 'e', 'l', 'l', 'o'}
-	got := skipLeadingContinuationBytes(data)
-	if !bytes.Equal(got, []byte("hello")) {
-		t.Fatalf("expected 'hello', got %q", got)
-	}
-}
-
-func TestSkipLeadingContinuationBytes_NoneToSkip(t *testing.T) {
-	data := []byte("hello")
-	got := skipLeadingContinuationBytes(data)
-	if !bytes.Equal(got, []byte("hello")) {
-		t.Fatalf("expected 'hello', got %q", got)
-	}
-}
-
 func TestRingBuffer_WrapSkipsOrphanedUTF8(t *testing.T) {
 	// Buffer size 8. Write "hello" (5 bytes) then "─X" (E2 94 80 58 = 4 bytes).
 	// Total 9 bytes into 8-byte buffer: wraps, oldest byte (h) is overwritten.
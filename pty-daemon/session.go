@@ -1,10 +1,15 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/exec"
+	"slices"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -22,21 +27,60 @@ type Session struct {
 	Rows     int
 	Alive    bool
 	ExitCode int
+	Exit     *ExitDetail // nil if still alive
+	Started  time.Time
 	ExitedAt time.Time // zero if still alive
 	mu       sync.Mutex
+
+	resizePolicy resizePolicy
+	sizes        map[string]sizeRequest // client ID → requested size
+
+	done chan struct{} // closed once the process has been reaped
+
+	limits      *SessionLimits
+	enforcement string
+	cgroupDir   string // empty when the session has no cgroup
+
+	ports []ListenPort // as of the last ScanPorts
+
+	input  *inputQueue
+	output *outputBatcher
+	flow   *flowGate
+	modes  *modeTracker
+
+	name     string
+	labels   map[string]string // replaced, never mutated, so List can share it
+	metadata map[string]string // likewise
+
+	entry     JournalEntry // as last written to the journal
+	journaled bool         // false once destroyed, so late writes don't revive it
+	// The ring offset the journaled scrollback ends at, and the file's
+	// size, or -1 when it must be rewritten whole (it may be left over
+	// from an earlier session with this ID). Guarded by the journal's mu.
+	journaledTo   uint64
+	journaledSize int64
+
+	bytesIn  atomic.Uint64
+	bytesOut atomic.Uint64
 }
 
 // SessionManager owns all PTY sessions and dispatches events to clients.
 type SessionManager struct {
 	mu       sync.RWMutex
 	sessions map[string]*Session
-	onData   func(sessionID string, data string)
-	onExit   func(sessionID string, exitCode int, pid int)
+	onData   func(sessionID string, data string, offset uint64) // offset is just past data
+	onExit   func(sessionID string, exitCode int, pid int, detail ExitDetail)
+	cgroups  *cgroupManager // nil when cgroups are unavailable
+	journal  *journal       // nil when journaling is off
+
+	// onDrained, if set, is called when a session's input backlog has
+	// been fully written to its PTY or discarded by an interrupt.
+	onDrained func(sessionID string, dropped int)
 }
 
 func NewSessionManager(
-	onData func(string, string),
-	onExit func(string, int, int),
+	onData func(string, string, uint64),
+	onExit func(string, int, int, ExitDetail),
 ) *SessionManager {
 	return &SessionManager{
 		sessions: make(map[string]*Session),
@@ -45,8 +89,46 @@ func NewSessionManager(
 	}
 }
 
+// UseCgroups places every subsequently created session in its own cgroup.
+func (sm *SessionManager) UseCgroups(m *cgroupManager) {
+	sm.cgroups = m
+}
+
+// UseJournal records every subsequently created session so it can be
+// resurrected later.
+func (sm *SessionManager) UseJournal(j *journal) {
+	sm.journal = j
+}
+
 // Create spawns a new PTY session with the given parameters.
 func (sm *SessionManager) Create(req CreateRequest) (*Session, error) {
+	return sm.create(req, nil, 0)
+}
+
+// create spawns a session whose scrollback starts with preface. restored
+// counts how many times it has been resurrected.
+func (sm *SessionManager) create(req CreateRequest, preface []byte, restored int) (*Session, error) {
+	cfg := currentConfig()
+	if req.ResizePolicy == "" {
+		req.ResizePolicy = cfg.ResizePolicy
+	}
+	if req.Limits == nil {
+		req.Limits = cfg.DefaultLimits
+	}
+	policy, err := parseResizePolicy(req.ResizePolicy)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateName(req.Name); err != nil {
+		return nil, err
+	}
+	if err := validateLabels(req.Labels); err != nil {
+		return nil, err
+	}
+	if err := validateMetadata(req.Metadata); err != nil {
+		return nil, err
+	}
+
 	cmd := exec.Command(req.Command, req.Args...)
 	cmd.Dir = req.Cwd
 
@@ -61,31 +143,121 @@ func (sm *SessionManager) Create(req CreateRequest) (*Session, error) {
 		Cols: uint16(req.Cols),
 		Rows: uint16(req.Rows),
 	}
+
+	var cgroupDir string
+	if sm.cgroups != nil {
+		dir, fd, err := sm.cgroups.create(req.ID, req.Limits)
+		if err != nil {
+			slog.Warn("session.cgroup_failed", "session", req.ID, "err", err)
+		} else {
+			defer fd.Close()
+			cgroupDir = dir
+			placeInCgroup(cmd, fd)
+		}
+	}
+
+	var enforcement string
+	if cgroupDir != "" {
+		enforcement = enforceCgroup
+	} else {
+		var ulimits []string
+		ulimits, enforcement = fallbackLimits(req.ID, req.Limits)
+		if len(ulimits) > 0 && cmd.Err == nil {
+			withUlimits(cmd, ulimits)
+		}
+	}
+
 	ptmx, err := pty.StartWithSize(cmd, winSize)
 	if err != nil {
+		if cgroupDir != "" {
+			sm.cgroups.remove(cgroupDir)
+		}
+		return nil, fmt.Errorf("pty start: %w", err)
+	}
+
+	ptmx, err = pollablePty(ptmx)
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Process.Wait()
+		if cgroupDir != "" {
+			sm.cgroups.remove(cgroupDir)
+		}
 		return nil, fmt.Errorf("pty start: %w", err)
 	}
 
 	sess := &Session{
-		ID:    req.ID,
-		Cmd:   cmd,
-		Pty:   ptmx,
-		Ring:  NewRingBuffer(DefaultRingSize),
-		Pid:   cmd.Process.Pid,
-		Cols:  req.Cols,
-		Rows:  req.Rows,
-		Alive: true,
+		ID:      req.ID,
+		Cmd:     cmd,
+		Pty:     ptmx,
+		Ring:    NewRingBuffer(cfg.RingSize),
+		Pid:     cmd.Process.Pid,
+		Cols:    req.Cols,
+		Rows:    req.Rows,
+		Alive:   true,
+		Started: time.Now(),
+
+		resizePolicy: policy,
+		sizes:        make(map[string]sizeRequest),
+		done:         make(chan struct{}),
+		input:        newInputQueue(),
+		output:       newOutputBatcher(),
+		flow:         newFlowGate(),
+		modes:        newModeTracker(),
+
+		limits:      req.Limits,
+		enforcement: enforcement,
+		cgroupDir:   cgroupDir,
+
+		name:     req.Name,
+		labels:   req.Labels,
+		metadata: req.Metadata,
+
+		entry: JournalEntry{
+			Request:   req,
+			LastCwd:   req.Cwd,
+			CreatedAt: time.Now().UnixMilli(),
+			Restored:  restored,
+		},
+		journaled:     true,
+		journaledSize: -1,
+	}
+	sess.entry.Request.Type = "create"
+	if len(preface) > 0 {
+		sess.Ring.Write(preface)
+		sess.modes.feed(preface)
 	}
 
 	sm.mu.Lock()
 	sm.sessions[req.ID] = sess
 	sm.mu.Unlock()
+	sm.journalSession(sess, len(preface) > 0)
+
+	// Write input in its own goroutine so a process that stops reading
+	// only stalls its own queue.
+	go sess.input.run(ptmx,
+		func(n int) { sess.bytesIn.Add(uint64(n)) },
+		func(dropped int) {
+			if sm.onDrained != nil {
+				sm.onDrained(req.ID, dropped)
+			}
+		})
+
+	// Send output in batches. The ring is written as each batch goes out,
+	// so scrollback and the data events clients have seen stay in step.
+	// The mode tracker follows the ring, never ahead of it, so its screen
+	// marks always point into output the ring has.
+	go sess.output.run(outputWait, func(batch []byte) {
+		sess.Ring.Write(batch)
+		sess.modes.feed(batch)
+		sm.onData(req.ID, string(batch), sess.Ring.Offset())
+	})
 
 	// Read PTY output in a goroutine.
 	go func() {
 		buf := make([]byte, 32*1024) // 32KB read buffer
-		var pending []byte            // incomplete UTF-8 tail from previous read
+		var pending []byte           // incomplete UTF-8 tail from previous read
 		for {
+			sess.flow.wait()
 			n, err := ptmx.Read(buf)
 			if n > 0 {
 				// Combine any pending incomplete UTF-8 bytes with new data.
@@ -110,40 +282,70 @@ func (sm *SessionManager) Create(req CreateRequest) (*Session, error) {
 				}
 
 				if len(chunk) > 0 {
-					data := string(chunk)
-					sess.Ring.Write(chunk)
-					sm.onData(req.ID, data)
+					sess.bytesOut.Add(uint64(len(chunk)))
+					sess.output.add(chunk)
 				}
 			}
 			if err != nil {
 				// Flush any remaining pending bytes on EOF.
 				if len(pending) > 0 {
-					data := string(pending)
-					sess.Ring.Write(pending)
-					sm.onData(req.ID, data)
+					sess.bytesOut.Add(uint64(len(pending)))
+					sess.output.add(pending)
 				}
 				break
 			}
 		}
+		sess.output.close()
+		sess.input.close()
 		// Wait for process to fully exit.
 		state, _ := cmd.Process.Wait()
 		exitCode := 0
 		if state != nil {
 			exitCode = state.ExitCode()
 		}
+		exitedAt := time.Now()
+		detail := exitDetail(state, sess.Started, exitedAt)
 		pid := sess.Pid
 		sess.mu.Lock()
 		sess.Alive = false
 		sess.ExitCode = exitCode
-		sess.ExitedAt = time.Now()
+		sess.Exit = &detail
+		sess.ExitedAt = exitedAt
+		sess.entry.ExitedAt = exitedAt.UnixMilli()
+		sess.entry.ExitCode = exitCode
 		sess.mu.Unlock()
-		sm.onExit(req.ID, exitCode, pid)
+		close(sess.done)
+		sm.journalSession(sess, true)
+		if cgroupDir != "" && sm.cgroups.remove(cgroupDir) == nil {
+			sess.mu.Lock()
+			sess.cgroupDir = ""
+			sess.mu.Unlock()
+		}
+		sm.onExit(req.ID, exitCode, pid, detail)
 	}()
 
 	return sess, nil
 }
 
-// Write sends input data to a PTY.
+// pollablePty reopens a PTY master in non-blocking mode, so it goes
+// through the runtime poller and closing it wakes a Read blocked on it.
+// pty.Start hands it over blocking, and a process outside the session can
+// keep a blocking Read waiting forever by holding the terminal open.
+func pollablePty(ptmx *os.File) (*os.File, error) {
+	defer ptmx.Close()
+	fd, err := syscall.Dup(int(ptmx.Fd()))
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), ptmx.Name()), nil
+}
+
+// Write queues input for a PTY. It fails, queuing nothing, if the session
+// already has more than maxPendingInput bytes waiting.
 func (sm *SessionManager) Write(id string, data string) error {
 	sm.mu.RLock()
 	sess, ok := sm.sessions[id]
@@ -151,46 +353,386 @@ func (sm *SessionManager) Write(id string, data string) error {
 	if !ok {
 		return fmt.Errorf("session not found: %s", id)
 	}
-	_, err := sess.Pty.Write([]byte(data))
-	return err
+	return sess.input.push([]byte(data), currentConfig().MaxPendingInput)
 }
 
-// Resize changes the PTY window size.
-func (sm *SessionManager) Resize(id string, cols, rows int) error {
+// WriteMany queues the same input on several sessions as one step: every
+// target's queue is locked before any is written, so no other input can
+// land between them and concurrent WriteMany calls reach every session in
+// the same order. check vets each target first (e.g. input permission).
+// With allOrNothing, one failing target means nothing is sent anywhere.
+// Results follow the order of ids; a repeated ID is written once and
+// repeats its first result.
+func (sm *SessionManager) WriteMany(ids []string, data string, allOrNothing bool, check func(id string) error) []WriteResult {
+	type target struct {
+		i int
+		q *inputQueue
+	}
+	results := make([]WriteResult, len(ids))
+	var targets []target
+	failed := false
+	first := make(map[string]int, len(ids))
+	for i, id := range ids {
+		results[i].ID = id
+		if _, dup := first[id]; dup {
+			continue // locking its queue twice would deadlock
+		}
+		first[id] = i
+		sess, err := sm.get(id)
+		if err == nil {
+			err = check(id)
+		}
+		if err != nil {
+			results[i].Error = err.Error()
+			failed = true
+			continue
+		}
+		targets = append(targets, target{i, sess.input})
+	}
+
+	// A fixed lock order keeps overlapping calls from deadlocking.
+	sort.Slice(targets, func(a, b int) bool { return ids[targets[a].i] < ids[targets[b].i] })
+	for _, t := range targets {
+		t.q.mu.Lock()
+	}
+	max := currentConfig().MaxPendingInput
+	for _, t := range targets {
+		if err := t.q.check([]byte(data), max); err != nil {
+			results[t.i].Error = err.Error()
+			failed = true
+		}
+	}
+	for _, t := range targets {
+		r := &results[t.i]
+		switch {
+		case r.Error != "":
+		case failed && allOrNothing:
+			r.Error = "not sent: another session failed"
+		default:
+			t.q.add([]byte(data))
+			r.OK = true
+		}
+	}
+	for _, t := range targets {
+		t.q.mu.Unlock()
+	}
+	for i, id := range ids {
+		results[i] = results[first[id]]
+	}
+	return results
+}
+
+// Keys queues named keys (see encodeKey), encoded for the application's
+// current cursor key mode.
+func (sm *SessionManager) Keys(id string, names []string) (int, error) {
+	sess, err := sm.get(id)
+	if err != nil {
+		return 0, err
+	}
+	data, err := encodeKeys(names, sess.modes.enabled(modeAppCursor))
+	if err != nil {
+		return 0, err
+	}
+	return len(data), sess.input.push(data, currentConfig().MaxPendingInput)
+}
+
+// Paste queues text as a terminal would paste it. Unless the caller
+// forces it either way, bracketed paste is used when the application has
+// turned it on. Returns whether it was bracketed and the bytes queued.
+func (sm *SessionManager) Paste(id, text string, bracketed *bool) (bool, int, error) {
+	sess, err := sm.get(id)
+	if err != nil {
+		return false, 0, err
+	}
+	useBrackets := sess.modes.enabled(modeBracketedPaste)
+	if bracketed != nil {
+		useBrackets = *bracketed
+	}
+	data := encodePaste(text, useBrackets)
+	return useBrackets, len(data), sess.input.push(data, currentConfig().MaxPendingInput)
+}
+
+// Pause stops or restarts reading a session's output. auto says which
+// source is asking: a client's request, or acknowledgements falling
+// behind. The session stays paused while either wants it. Returns whether
+// that changed and whether it is now paused. A process that exits while
+// paused isn't noticed until it is resumed, as its last output is unread.
+func (sm *SessionManager) Pause(id string, auto, on bool) (changed, paused bool, err error) {
+	sess, err := sm.get(id)
+	if err != nil {
+		return false, false, err
+	}
+	changed, paused = sess.flow.set(auto, on)
+	return changed, paused, nil
+}
+
+// Resize records a client's requested size and applies the session's
+// resize policy. changed reports whether the PTY size actually moved.
+func (sm *SessionManager) Resize(id, clientID string, cols, rows int, viewer bool, controller string) (ptySize, bool, error) {
+	sess, err := sm.get(id)
+	if err != nil {
+		return ptySize{}, false, err
+	}
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	sess.sizes[clientID] = sizeRequest{Cols: cols, Rows: rows, Active: time.Now(), Viewer: viewer}
+	return sess.applySize(controller)
+}
+
+// DropClientSize forgets a detached client's size and re-arbitrates.
+func (sm *SessionManager) DropClientSize(id, clientID, controller string) (ptySize, bool, error) {
+	sess, err := sm.get(id)
+	if err != nil {
+		return ptySize{}, false, err
+	}
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	delete(sess.sizes, clientID)
+	return sess.applySize(controller)
+}
+
+// Rearbitrate reapplies the resize policy, e.g. after control changes hands,
+// with viewers the clients now attached as viewers.
+func (sm *SessionManager) Rearbitrate(id, controller string, viewers map[string]bool) (ptySize, bool, error) {
+	sess, err := sm.get(id)
+	if err != nil {
+		return ptySize{}, false, err
+	}
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	for clientID, r := range sess.sizes {
+		r.Viewer = viewers[clientID]
+		sess.sizes[clientID] = r
+	}
+	return sess.applySize(controller)
+}
+
+// NoteActivity marks a client as the most recently active one, which is
+// what policyLatest follows, and re-arbitrates.
+func (sm *SessionManager) NoteActivity(id, clientID, controller string) (ptySize, bool, error) {
+	sess, err := sm.get(id)
+	if err != nil {
+		return ptySize{}, false, err
+	}
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if r, ok := sess.sizes[clientID]; ok {
+		r.Active = time.Now()
+		sess.sizes[clientID] = r
+	}
+	return sess.applySize(controller)
+}
+
+// applySize sets the PTY to the size the policy picks. Caller holds s.mu.
+func (s *Session) applySize(controller string) (ptySize, bool, error) {
+	cols, rows, ok := arbitrateSize(s.resizePolicy, s.sizes, controller)
+	if !ok || (cols == s.Cols && rows == s.Rows) {
+		return ptySize{Cols: s.Cols, Rows: s.Rows}, false, nil
+	}
+	if s.Alive {
+		if err := pty.Setsize(s.Pty, &pty.Winsize{
+			Cols: uint16(cols),
+			Rows: uint16(rows),
+		}); err != nil {
+			return ptySize{Cols: s.Cols, Rows: s.Rows}, false, err
+		}
+	}
+	s.Cols = cols
+	s.Rows = rows
+	return ptySize{Cols: cols, Rows: rows}, true, nil
+}
+
+// Update applies an update request to a session's name, labels and
+// metadata, journals the result and returns it.
+func (sm *SessionManager) Update(req UpdateRequest) (UpdatedEvent, error) {
+	sess, err := sm.get(req.ID)
+	if err != nil {
+		return UpdatedEvent{}, err
+	}
+	sess.mu.Lock()
+	name := sess.name
+	if req.Name != nil {
+		name = *req.Name
+	}
+	labels := sess.labels
+	if req.Labels != nil {
+		labels = mergeMap(labels, req.Labels)
+	}
+	metadata := sess.metadata
+	if req.Metadata != nil {
+		metadata = mergeMap(metadata, req.Metadata)
+	}
+	err = errors.Join(validateName(name), validateLabels(labels), validateMetadata(metadata))
+	if err == nil {
+		sess.name, sess.labels, sess.metadata = name, labels, metadata
+		sess.entry.Request.Name = name
+		sess.entry.Request.Labels = labels
+		sess.entry.Request.Metadata = metadata
+	}
+	sess.mu.Unlock()
+	if err != nil {
+		return UpdatedEvent{}, err
+	}
+	sm.journalSession(sess, false)
+	return UpdatedEvent{Type: "updated", ID: req.ID, Name: name, Labels: labels, Metadata: metadata}, nil
+}
+
+// get looks up a session by ID.
+func (sm *SessionManager) get(id string) (*Session, error) {
 	sm.mu.RLock()
 	sess, ok := sm.sessions[id]
 	sm.mu.RUnlock()
 	if !ok {
-		return fmt.Errorf("session not found: %s", id)
+		return nil, fmt.Errorf("session not found: %s", id)
 	}
-	sess.mu.Lock()
-	sess.Cols = cols
-	sess.Rows = rows
-	sess.mu.Unlock()
-	return pty.Setsize(sess.Pty, &pty.Winsize{
-		Cols: uint16(cols),
-		Rows: uint16(rows),
-	})
+	return sess, nil
 }
 
-// Destroy kills a PTY session and removes it.
+// Destroy kills a PTY session and removes it, journal entry included.
 func (sm *SessionManager) Destroy(id string) {
+	if sess := sm.remove(id); sess != nil {
+		sm.unjournal(sess)
+		sess.hangup()
+	}
+}
+
+// remove takes a session out of the manager, returning nil if it's unknown.
+func (sm *SessionManager) remove(id string) *Session {
 	sm.mu.Lock()
+	defer sm.mu.Unlock()
 	sess, ok := sm.sessions[id]
 	if !ok {
-		sm.mu.Unlock()
-		return
+		return nil
 	}
 	delete(sm.sessions, id)
-	sm.mu.Unlock()
+	return sess
+}
+
+// hangup sends SIGHUP to a live session and closes its PTY.
+func (s *Session) hangup() {
+	s.mu.Lock()
+	alive := s.Alive
+	s.mu.Unlock()
+	if alive {
+		s.flow.release()
+		_ = s.Cmd.Process.Signal(syscall.SIGHUP)
+		s.Pty.Close()
+	}
+}
 
-	if sess.Alive {
-		_ = sess.Cmd.Process.Signal(syscall.SIGHUP)
+// escalation is how long DestroyGraceful waits after each signal.
+type escalation struct {
+	AfterHup  time.Duration
+	AfterTerm time.Duration
+	AfterKill time.Duration
+}
+
+// DestroyGraceful sends SIGHUP to the leader, then SIGTERM and SIGKILL to
+// the whole process tree, waiting between steps for the session to exit.
+// It returns the signal that ended the session ("exited" if it was already
+// dead), then closes the PTY and removes the session. The PTY is closed
+// straight after SIGKILL: a process that left the tree, such as a daemonized
+// grandchild, can hold the terminal open, and the session would never see
+// EOF.
+func (sm *SessionManager) DestroyGraceful(id string, esc escalation) (string, error) {
+	sess, err := sm.get(id)
+	if err != nil {
+		return "", err
+	}
+	sm.unjournal(sess)
+	sess.flow.release()
+	defer func() {
+		sm.mu.Lock()
+		if sm.sessions[id] == sess {
+			delete(sm.sessions, id)
+		}
+		sm.mu.Unlock()
 		sess.Pty.Close()
+	}()
+
+	select {
+	case <-sess.done:
+		return "exited", nil
+	default:
+	}
+	steps := []struct {
+		sig  syscall.Signal
+		wait time.Duration
+	}{
+		{syscall.SIGHUP, esc.AfterHup},
+		{syscall.SIGTERM, esc.AfterTerm},
+		{syscall.SIGKILL, esc.AfterKill},
+	}
+	for _, step := range steps {
+		if step.sig == syscall.SIGHUP {
+			_ = sess.Cmd.Process.Signal(step.sig)
+		} else {
+			signalTree(sess.Pid, step.sig)
+		}
+		if step.sig == syscall.SIGKILL {
+			sess.Pty.Close()
+		}
+		select {
+		case <-sess.done:
+			return signalName(step.sig), nil
+		case <-time.After(step.wait):
+		}
+	}
+	return signalName(syscall.SIGKILL), fmt.Errorf("session %s did not exit after SIGKILL", id)
+}
+
+// Signal sends sig to the chosen processes of a live session and returns
+// the pids signalled (a negative pid is a process group). pid is only used
+// with targetPid.
+func (sm *SessionManager) Signal(id string, sig syscall.Signal, target signalTarget, pid int) ([]int, error) {
+	sess, err := sm.get(id)
+	if err != nil {
+		return nil, err
+	}
+	sess.mu.Lock()
+	alive := sess.Alive
+	sess.mu.Unlock()
+	if !alive {
+		return nil, fmt.Errorf("session not running: %s", id)
+	}
+
+	switch target {
+	case targetForeground:
+		pgid, err := foregroundPgid(sess.Pty)
+		if err != nil {
+			return nil, fmt.Errorf("foreground process group: %w", err)
+		}
+		if err := syscall.Kill(-pgid, sig); err != nil {
+			return nil, err
+		}
+		return []int{-pgid}, nil
+	case targetTree:
+		return signalTree(sess.Pid, sig)
+	case targetPid:
+		// Only processes under this session; the daemon shouldn't become
+		// a way to signal arbitrary processes of the user.
+		pids, err := treePids(sess.Pid)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(pids, pid) {
+			return nil, fmt.Errorf("pid %d is not part of session %s", pid, id)
+		}
+		if err := syscall.Kill(pid, sig); err != nil {
+			return nil, err
+		}
+		return []int{pid}, nil
+	default:
+		if err := sess.Cmd.Process.Signal(sig); err != nil {
+			return nil, err
+		}
+		return []int{sess.Pid}, nil
 	}
 }
 
-// DestroyAll kills all sessions. Used during daemon shutdown.
+// DestroyAll kills all sessions. Used during daemon shutdown, so unlike
+// Destroy it keeps their journal entries, marked as stopped, with a final
+// scrollback snapshot.
 func (sm *SessionManager) DestroyAll() {
 	sm.mu.Lock()
 	ids := make([]string, 0, len(sm.sessions))
@@ -198,8 +740,22 @@ func (sm *SessionManager) DestroyAll() {
 		ids = append(ids, id)
 	}
 	sm.mu.Unlock()
+	now := time.Now().UnixMilli()
 	for _, id := range ids {
-		sm.Destroy(id)
+		sess := sm.remove(id)
+		if sess == nil {
+			continue
+		}
+		sess.mu.Lock()
+		alive := sess.Alive
+		if alive {
+			sess.entry.StoppedAt = now
+		}
+		sess.mu.Unlock()
+		if alive {
+			sm.journalSession(sess, true)
+		}
+		sess.hangup()
 	}
 }
 
@@ -217,38 +773,321 @@ func (sm *SessionManager) List() []SessionInfo {
 			Rows:     s.Rows,
 			Alive:    s.Alive,
 			ExitCode: s.ExitCode,
+
+			ResizePolicy: string(s.resizePolicy),
+			StartedAt:    s.Started.UnixMilli(),
+			Enforcement:  s.enforcement,
+			Ports:        s.ports,
+			Name:         s.name,
+			Labels:       s.labels,
+			Metadata:     s.metadata,
+			Modes:        s.modes.list(),
+			Paused:       s.flow.paused(),
+			ExitDetail:   s.Exit,
 		})
 		s.mu.Unlock()
 	}
 	return out
 }
 
-// GetScrollback returns the ring buffer contents as a string.
-func (sm *SessionManager) GetScrollback(id string) (string, error) {
+// GetScrollback returns the ring buffer contents as a string, and the
+// output offset just past them.
+func (sm *SessionManager) GetScrollback(id string) (string, uint64, error) {
 	sm.mu.RLock()
 	sess, ok := sm.sessions[id]
 	sm.mu.RUnlock()
 	if !ok {
-		return "", fmt.Errorf("session not found: %s", id)
+		return "", 0, fmt.Errorf("session not found: %s", id)
 	}
-	return string(sess.Ring.Contents()), nil
+	snap := sess.Ring.Snapshot()
+	return string(snap.span(snap.start, snap.end(), false)), snap.end(), nil
 }
 
-// SweepDead removes sessions that have been dead for longer than maxAge.
-func (sm *SessionManager) SweepDead(maxAge time.Duration) int {
+// ScreenScrollback returns scrollback trimmed to what shows the current
+// screen, with up to history bytes from before it (see trimReplay), and
+// the output offset just past it.
+func (sm *SessionManager) ScreenScrollback(id string, history int) (string, uint64, error) {
+	sess, err := sm.get(id)
+	if err != nil {
+		return "", 0, err
+	}
+	// Marks first: they never run ahead of the ring, so they're all
+	// within the snapshot taken after.
+	marks, modes := sess.modes.screen()
+	snap := sess.Ring.Snapshot()
+	return string(trimReplay(snap, marks, modes, history)), snap.end(), nil
+}
+
+// Output returns the part of a session's scrollback in r that the ring
+// still holds, starting at a clean point with the SGR state restored.
+func (sm *SessionManager) Output(id string, r OutputRange) (OutputResponse, error) {
+	sess, err := sm.get(id)
+	if err != nil {
+		return OutputResponse{}, err
+	}
+	index := sess.Ring.TimeIndex()
+	snap := sess.Ring.Snapshot()
+	from, to := r.resolve(index, snap.start, snap.end())
+	resp := OutputResponse{Type: "output", ID: id, From: from, To: to, Data: string(snap.span(from, to, false))}
+	if from < to {
+		resp.Since, resp.Until = timeOf(index, from), timeOf(index, to-1)
+	}
+	return resp, nil
+}
+
+// Times returns when the output at each offset was written (unix ms, 0 if
+// unknown), or the session's whole time index when offsets is empty.
+func (sm *SessionManager) Times(id string, offsets []uint64) ([]int64, []TimeMark, error) {
+	sess, err := sm.get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	index := sess.Ring.TimeIndex()
+	if len(offsets) == 0 {
+		return nil, index, nil
+	}
+	times := make([]int64, len(offsets))
+	for i, off := range offsets {
+		times[i] = timeOf(index, off)
+	}
+	return times, nil, nil
+}
+
+// OutputOffset returns how many bytes of output a session has sent to
+// clients.
+func (sm *SessionManager) OutputOffset(id string) (uint64, error) {
+	sess, err := sm.get(id)
+	if err != nil {
+		return 0, err
+	}
+	return sess.Ring.Offset(), nil
+}
+
+// SweepDead removes sessions that have been dead for longer than maxAge,
+// returning their IDs.
+func (sm *SessionManager) SweepDead(maxAge time.Duration) []string {
 	now := time.Now()
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	swept := 0
+	var swept []string
 	for id, s := range sm.sessions {
 		s.mu.Lock()
 		dead := !s.Alive && !s.ExitedAt.IsZero() && now.Sub(s.ExitedAt) > maxAge
+		cgroupDir := s.cgroupDir
 		s.mu.Unlock()
 		if dead {
 			delete(sm.sessions, id)
-			swept++
+			swept = append(swept, id)
+			// Retry removing a cgroup that stragglers kept busy at exit.
+			if cgroupDir != "" {
+				sm.cgroups.remove(cgroupDir)
+			}
 		}
 	}
 	return swept
 }
+
+// Stats returns live resource usage for one session, or all when id is "".
+func (sm *SessionManager) Stats(id string) ([]SessionStats, error) {
+	var sessions []*Session
+	if id != "" {
+		sess, err := sm.get(id)
+		if err != nil {
+			return nil, err
+		}
+		sessions = []*Session{sess}
+	} else {
+		sm.mu.RLock()
+		for _, s := range sm.sessions {
+			sessions = append(sessions, s)
+		}
+		sm.mu.RUnlock()
+	}
+
+	// One process-table scan serves every session without a cgroup.
+	var procs []procStat
+	var procsErr error
+	scanned := false
+
+	out := make([]SessionStats, 0, len(sessions))
+	for _, s := range sessions {
+		s.mu.Lock()
+		st := SessionStats{
+			ID:          s.ID,
+			Alive:       s.Alive,
+			Limits:      s.limits,
+			Enforcement: s.enforcement,
+		}
+		dir := s.cgroupDir
+		s.mu.Unlock()
+		st.BytesIn = s.bytesIn.Load()
+		st.BytesOut = s.bytesOut.Load()
+		st.RingUsed = s.Ring.Len()
+		st.InputPending = s.input.Len()
+
+		if dir != "" {
+			st.Source = enforceCgroup
+			st.CPUMs, st.MemoryBytes, st.Processes = cgroupStats(dir)
+		} else {
+			st.Source = "tree"
+			if st.Alive {
+				if !scanned {
+					procs, procsErr = listProcs()
+					scanned = true
+				}
+				if procsErr != nil {
+					return nil, fmt.Errorf("process table: %w", procsErr)
+				}
+				st.CPUMs, st.MemoryBytes, st.Processes = treeStats(procs, s.Pid)
+			}
+		}
+		out = append(out, st)
+	}
+	return out, nil
+}
+
+// Processes returns the process tree under a live session's leader,
+// marking members of the PTY's foreground process group.
+func (sm *SessionManager) Processes(id string) (int, []ProcessInfo, error) {
+	sess, err := sm.get(id)
+	if err != nil {
+		return 0, nil, err
+	}
+	sess.mu.Lock()
+	alive := sess.Alive
+	sess.mu.Unlock()
+	if !alive {
+		return 0, []ProcessInfo{}, nil
+	}
+
+	fg, _ := foregroundPgid(sess.Pty)
+	procs, err := listProcs()
+	if err != nil {
+		return 0, nil, fmt.Errorf("process table: %w", err)
+	}
+	tree := processTree(procs, sess.Pid)
+	out := make([]ProcessInfo, 0, len(tree))
+	for _, n := range tree {
+		argv, cwd := procDetails(n.Pid)
+		out = append(out, ProcessInfo{
+			Pid:        n.Pid,
+			Ppid:       n.Ppid,
+			Pgid:       n.Pgid,
+			Depth:      n.Depth,
+			State:      n.State,
+			Command:    argv,
+			Cwd:        cwd,
+			CPUMs:      n.CPU.Milliseconds(),
+			RSSBytes:   n.RSSBytes,
+			Foreground: fg != 0 && n.Pgid == fg,
+		})
+	}
+	return fg, out, nil
+}
+
+// ScanPorts refreshes each session's listening TCP ports and returns an
+// event for every port opened or closed since the previous scan. Exited
+// sessions report their remaining ports as closed. The process and socket
+// tables are read once for all sessions, and not at all when none is
+// running.
+func (sm *SessionManager) ScanPorts() ([]PortEvent, error) {
+	type scan struct {
+		s     *Session
+		alive bool
+		prev  []ListenPort
+	}
+	sm.mu.RLock()
+	sessions := make([]*Session, 0, len(sm.sessions))
+	for _, s := range sm.sessions {
+		sessions = append(sessions, s)
+	}
+	sm.mu.RUnlock()
+
+	var scans []scan
+	trees := make(map[*Session][]int)
+	anyAlive := false
+	for _, s := range sessions {
+		s.mu.Lock()
+		alive, prev := s.Alive, s.ports
+		s.mu.Unlock()
+		if alive || len(prev) > 0 {
+			scans = append(scans, scan{s: s, alive: alive, prev: prev})
+			anyAlive = anyAlive || alive
+		}
+	}
+	if len(scans) == 0 {
+		return nil, nil
+	}
+
+	var found map[int][]ListenPort
+	if anyAlive {
+		procs, err := listProcs()
+		if err != nil {
+			return nil, fmt.Errorf("process table: %w", err)
+		}
+		var all []int
+		for _, sc := range scans {
+			if !sc.alive {
+				continue
+			}
+			for _, p := range descendants(procs, sc.s.Pid) {
+				trees[sc.s] = append(trees[sc.s], p.Pid)
+				all = append(all, p.Pid)
+			}
+		}
+		if found, err = listeningPorts(all); err != nil {
+			return nil, fmt.Errorf("listening sockets: %w", err)
+		}
+	}
+
+	var events []PortEvent
+	for _, sc := range scans {
+		s, prev := sc.s, sc.prev
+		var next []ListenPort
+		if sc.alive {
+			next = sessionPorts(trees[s], found)
+		}
+		opened, closed := diffPorts(prev, next)
+		for _, p := range opened {
+			events = append(events, PortEvent{Type: "port", ID: s.ID, Listening: true, ListenPort: p})
+		}
+		for _, p := range closed {
+			events = append(events, PortEvent{Type: "port", ID: s.ID, Listening: false, ListenPort: p})
+		}
+		s.mu.Lock()
+		s.ports = next
+		s.mu.Unlock()
+	}
+	return events, nil
+}
+
+// Totals counts sessions by state and sums ring buffer memory.
+func (sm *SessionManager) Totals() (alive, dead int, ringAlloc, ringUsed int64) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	for _, s := range sm.sessions {
+		s.mu.Lock()
+		if s.Alive {
+			alive++
+		} else {
+			dead++
+		}
+		s.mu.Unlock()
+		ringAlloc += int64(s.Ring.Cap())
+		ringUsed += int64(s.Ring.Len())
+	}
+	return alive, dead, ringAlloc, ringUsed
+}
+
+// IOCounts returns each session's input and output byte counters, by ID.
+func (sm *SessionManager) IOCounts() []SessionStats {
+	sm.mu.RLock()
+	out := make([]SessionStats, 0, len(sm.sessions))
+	for _, s := range sm.sessions {
+		out = append(out, SessionStats{ID: s.ID, BytesIn: s.bytesIn.Load(), BytesOut: s.bytesOut.Load()})
+	}
+	sm.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
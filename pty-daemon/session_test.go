@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+// newTestManager returns a session manager that ignores output and exits.
+func newTestManager() *SessionManager {
+	return NewSessionManager(func(string, string, uint64) {}, func(string, int, int, ExitDetail) {})
+}
+
+// startTestSession runs script under /bin/sh as session id, destroying it
+// when the test ends. Each of with may adjust the request first.
+func startTestSession(t *testing.T, sm *SessionManager, id, script string, with ...func(*CreateRequest)) *Session {
+	t.Helper()
+	req := CreateRequest{
+		ID:      id,
+		Command: "/bin/sh",
+		Args:    []string{"-c", script},
+		Env:     map[string]string{"PATH": "/usr/bin:/bin"},
+		Cols:    80,
+		Rows:    24,
+	}
+	for _, f := range with {
+		f(&req)
+	}
+	sess, err := sm.Create(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sm.Destroy(id) })
+	return sess
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// signalsByName lists the signals clients can ask for by name.
+var signalsByName = map[string]syscall.Signal{
+	"HUP":   syscall.SIGHUP,
+	"INT":   syscall.SIGINT,
+	"QUIT":  syscall.SIGQUIT,
+	"ABRT":  syscall.SIGABRT,
+	"KILL":  syscall.SIGKILL,
+	"USR1":  syscall.SIGUSR1,
+	"USR2":  syscall.SIGUSR2,
+	"PIPE":  syscall.SIGPIPE,
+	"ALRM":  syscall.SIGALRM,
+	"TERM":  syscall.SIGTERM,
+	"CONT":  syscall.SIGCONT,
+	"STOP":  syscall.SIGSTOP,
+	"TSTP":  syscall.SIGTSTP,
+	"TTIN":  syscall.SIGTTIN,
+	"TTOU":  syscall.SIGTTOU,
+	"WINCH": syscall.SIGWINCH,
+}
+
+// parseSignal accepts "SIGINT", "INT", "int" or a number.
+func parseSignal(s string) (syscall.Signal, error) {
+	s = strings.TrimSpace(s)
+	name := strings.TrimPrefix(strings.ToUpper(s), "SIG")
+	if sig, ok := signalsByName[name]; ok {
+		return sig, nil
+	}
+	if n, err := strconv.Atoi(s); err == nil && n > 0 && n < 65 {
+		return syscall.Signal(n), nil
+	}
+	return 0, fmt.Errorf("unknown signal: %s", s)
+}
+
+// signalName returns "SIGTERM" for SIGTERM, or "SIG<n>" for signals
+// without a name in signalsByName.
+func signalName(sig syscall.Signal) string {
+	for name, s := range signalsByName {
+		if s == sig {
+			return "SIG" + name
+		}
+	}
+	return fmt.Sprintf("SIG%d", int(sig))
+}
+
+// signalTarget selects which processes of a session receive a signal.
+type signalTarget string
+
+const (
+	// targetLeader is the process the session was created with.
+	targetLeader signalTarget = "leader"
+	// targetForeground is the PTY's foreground process group, which is
+	// what Ctrl-C would reach if the terminal weren't in raw mode.
+	targetForeground signalTarget = "foreground"
+	// targetTree is the leader and all of its descendants.
+	targetTree signalTarget = "tree"
+	// targetPid is one process from the session's tree.
+	targetPid signalTarget = "pid"
+)
+
+// parseSignalTarget maps the wire value to a target. Empty means leader.
+func parseSignalTarget(s string) (signalTarget, error) {
+	switch t := signalTarget(s); t {
+	case "":
+		return targetLeader, nil
+	case targetLeader, targetForeground, targetTree, targetPid:
+		return t, nil
+	}
+	return "", fmt.Errorf("unknown signal target: %s", s)
+}
+
+// foregroundPgid returns the PTY's foreground process group (TIOCGPGRP).
+// It goes through SyscallConn because Fd would put the PTY back in
+// blocking mode (see pollablePty).
+func foregroundPgid(ptmx *os.File) (int, error) {
+	conn, err := ptmx.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var pgid int32
+	var errno syscall.Errno
+	err = conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd,
+			uintptr(syscall.TIOCGPGRP), uintptr(unsafe.Pointer(&pgid)))
+	})
+	if err != nil {
+		return 0, err
+	}
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(pgid), nil
+}
+
+// treePids returns the pids of root and its descendants, parents first.
+func treePids(root int) ([]int, error) {
+	procs, err := listProcs()
+	if err != nil {
+		return nil, err
+	}
+	tree := descendants(procs, root)
+	pids := make([]int, len(tree))
+	for i, p := range tree {
+		pids[i] = p.Pid
+	}
+	return pids, nil
+}
+
+// signalTree sends sig to root and all its descendants. Processes that
+// exit before being signalled are not an error.
+func signalTree(root int, sig syscall.Signal) ([]int, error) {
+	pids, err := treePids(root)
+	if err != nil {
+		return nil, err
+	}
+	if len(pids) == 0 {
+		pids = []int{root}
+	}
+	var sent []int
+	for _, pid := range pids {
+		if err := syscall.Kill(pid, sig); err == nil {
+			sent = append(sent, pid)
+		}
+	}
+	return sent, nil
+}
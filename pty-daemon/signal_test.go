@@ -0,0 +1,86 @@
+package main
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseSignal(t *testing.T) {
+	for _, in := range []string{"SIGINT", "INT", "int", "2", " 2", "2\n", " sigint "} {
+		sig, err := parseSignal(in)
+		if err != nil || sig != syscall.SIGINT {
+			t.Errorf("%q: expected SIGINT, got %v, %v", in, sig, err)
+		}
+	}
+	if _, err := parseSignal("SIGNOPE"); err == nil {
+		t.Fatal("expected error for unknown signal")
+	}
+	if got := signalName(syscall.SIGTERM); got != "SIGTERM" {
+		t.Fatalf("expected SIGTERM, got %s", got)
+	}
+}
+
+func TestDescendants(t *testing.T) {
+	procs := []procStat{
+		{Pid: 1, Ppid: 0},
+		{Pid: 10, Ppid: 1},
+		{Pid: 12, Ppid: 10},
+		{Pid: 11, Ppid: 10},
+		{Pid: 13, Ppid: 12},
+		{Pid: 20, Ppid: 1},
+	}
+	got := descendants(procs, 10)
+	want := []int{10, 11, 12, 13}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i, p := range got {
+		if p.Pid != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+	if descendants(procs, 99) != nil {
+		t.Fatal("expected nil for unknown root")
+	}
+}
+
+func TestDestroyGraceful_EscalatesPastIgnoredHup(t *testing.T) {
+	sm := newTestManager()
+	startTestSession(t, sm, "g1", `trap "" HUP; echo ready; while :; do sleep 1; done`)
+	time.Sleep(200 * time.Millisecond) // let the trap install
+	step, err := sm.DestroyGraceful("g1", escalation{
+		AfterHup:  300 * time.Millisecond,
+		AfterTerm: 2 * time.Second,
+		AfterKill: 2 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if step != "SIGTERM" {
+		t.Fatalf("expected session to end on SIGTERM, got %s", step)
+	}
+	if len(sm.List()) != 0 {
+		t.Fatal("session should be removed after destroy")
+	}
+}
+
+func TestDestroyGraceful_ClosesPtyHeldByOrphan(t *testing.T) {
+	sm := newTestManager()
+	// The subshell exits at once, leaving a sleep outside the session's
+	// process tree that ignores SIGHUP and still holds the terminal.
+	startTestSession(t, sm, "g2", `(trap "" HUP; sleep 3 &); echo ready; exec sleep 30`)
+	time.Sleep(200 * time.Millisecond)
+	start := time.Now()
+	step, err := sm.DestroyGraceful("g2", escalation{
+		AfterHup:  100 * time.Millisecond,
+		AfterTerm: 100 * time.Millisecond,
+		AfterKill: 2 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("expected the session to end, got %s, %v", step, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("destroy waited %v for the orphan", elapsed)
+	}
+}
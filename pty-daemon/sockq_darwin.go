@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// soNwrite is SO_NWRITE from <sys/socket.h>: bytes not yet sent.
+const soNwrite = 0x1024
+
+// socketQueued returns the bytes sitting unsent in a socket's send queue.
+func socketQueued(conn net.Conn) (int, error) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return 0, nil
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	var optErr error
+	err = raw.Control(func(fd uintptr) {
+		n, optErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, soNwrite)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, optErr
+}
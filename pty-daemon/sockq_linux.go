@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+// socketQueued returns the bytes sitting unsent in a socket's send queue
+// (SIOCOUTQ). For a unix socket that's output the client hasn't read yet.
+func socketQueued(conn net.Conn) (int, error) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return 0, nil
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var n int32
+	var errno syscall.Errno
+	err = raw.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TIOCOUTQ, uintptr(unsafe.Pointer(&n)))
+	})
+	if err != nil {
+		return 0, err
+	}
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(n), nil
+}
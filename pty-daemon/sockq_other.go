@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package main
+
+import "net"
+
+// socketQueued is unknown on this platform and reported as 0.
+func socketQueued(conn net.Conn) (int, error) { return 0, nil }
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+)
+
+// listenFDsStart is the first file descriptor systemd passes (SD_LISTEN_FDS_START).
+const listenFDsStart = 3
+
+// systemdListener returns the socket systemd passed us via socket
+// activation, or nil if we weren't socket-activated. The LISTEN_* variables
+// are cleared so session shells don't inherit them.
+func systemdListener() (net.Listener, error) {
+	n, err := listenFDs(os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"))
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	if n > 1 {
+		return nil, fmt.Errorf("expected one socket from systemd, got %d", n)
+	}
+	syscall.CloseOnExec(listenFDsStart)
+	f := os.NewFile(listenFDsStart, "systemd-socket")
+	defer f.Close() // FileListener dups the fd
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := ln.(*net.UnixListener); !ok {
+		ln.Close()
+		return nil, fmt.Errorf("systemd socket is %T, want a unix stream socket", ln)
+	}
+	return ln, nil
+}
+
+// listenFDs interprets LISTEN_PID and LISTEN_FDS. The fds are only ours if
+// LISTEN_PID names this process.
+func listenFDs(pid, fds string) (int, error) {
+	if pid == "" || fds == "" {
+		return 0, nil
+	}
+	if p, err := strconv.Atoi(pid); err != nil || p != os.Getpid() {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(fds)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid LISTEN_FDS %q", fds)
+	}
+	return n, nil
+}
+
+// sdNotify sends a state update to the service manager. It does nothing
+// when not running under systemd (NOTIFY_SOCKET unset).
+func sdNotify(state string) error {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return nil
+	}
+	if addr[0] == '@' {
+		addr = "\x00" + addr[1:] // abstract namespace
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// watchdogInterval returns how often to ping the watchdog: half of
+// WATCHDOG_USEC, as sd_watchdog_enabled(3) recommends. Zero means the
+// watchdog is off.
+func watchdogInterval() time.Duration {
+	if p := os.Getenv("WATCHDOG_PID"); p != "" && p != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// runWatchdog pings the watchdog for as long as healthy returns, so a
+// daemon wedged on a lock gets restarted instead of silently hanging.
+func runWatchdog(interval time.Duration, healthy func()) {
+	for {
+		time.Sleep(interval)
+		healthy()
+		sdNotify("WATCHDOG=1")
+	}
+}
+
+// unitName is the base name of the installed systemd units.
+const unitName = "pty-daemon"
+
+var serviceTemplate = template.Must(template.New("service").Parse(`[Unit]
+Description=spaceterm PTY daemon
+Requires={{.Name}}.socket
+After={{.Name}}.socket
+
+[Service]
+Type=notify
+NotifyAccess=main
+ExecStart={{.Exe}} run
+ExecReload=/bin/kill -HUP $MAINPID
+{{- if .Home}}
+Environment=SPACETERM_HOME={{.Home}}
+{{- end}}
+Restart=on-failure
+RestartSec=1
+WatchdogSec=30
+# Let the daemon give each session its own cgroup with limits.
+Delegate=yes
+
+[Install]
+WantedBy=default.target
+`))
+
+var socketTemplate = template.Must(template.New("socket").Parse(`[Unit]
+Description=spaceterm PTY daemon socket
+
+[Socket]
+ListenStream={{.Socket}}
+SocketMode={{.SocketMode}}
+DirectoryMode={{.DirMode}}
+
+[Install]
+WantedBy=sockets.target
+`))
+
+// unitParams fills the unit templates.
+type unitParams struct {
+	Name   string
+	Exe    string
+	Home   string // SPACETERM_HOME, if set
+	Socket string
+	Shared bool // other uids are allowed to connect
+}
+
+// SocketMode and DirMode are the unit's permissions, as the daemon would
+// set them itself.
+func (p unitParams) SocketMode() string {
+	_, sock := socketModes(p.Shared)
+	return fmt.Sprintf("%04o", sock)
+}
+
+func (p unitParams) DirMode() string {
+	dir, _ := socketModes(p.Shared)
+	return fmt.Sprintf("%04o", dir)
+}
+
+// renderUnits returns the service and socket unit files.
+func renderUnits(p unitParams) (service, socket string, err error) {
+	var b strings.Builder
+	if err := serviceTemplate.Execute(&b, p); err != nil {
+		return "", "", err
+	}
+	service = b.String()
+	b.Reset()
+	if err := socketTemplate.Execute(&b, p); err != nil {
+		return "", "", err
+	}
+	return service, b.String(), nil
+}
+
+// userUnitDir is where systemd looks for user units.
+func userUnitDir() string {
+	if d := os.Getenv("XDG_CONFIG_HOME"); d != "" {
+		return filepath.Join(d, "systemd", "user")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config", "systemd", "user")
+}
+
+// cmdInstallUnit writes the systemd user units for the daemon:
+// pty-daemon install-unit [--stdout]
+func cmdInstallUnit(args []string) {
+	toStdout := false
+	for _, a := range args {
+		switch a {
+		case "--stdout":
+			toStdout = true
+		default:
+			fail("Usage: pty-daemon install-unit [--stdout]")
+		}
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		fail("Failed to find executable: %v", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	service, socket, err := renderUnits(unitParams{
+		Name:   unitName,
+		Exe:    exe,
+		Home:   os.Getenv("SPACETERM_HOME"),
+		Socket: socketPath(),
+		Shared: len(currentConfig().AllowedUids) > 0,
+	})
+	if err != nil {
+		fail("%v", err)
+	}
+	if toStdout {
+		fmt.Printf("# %s.service\n%s\n# %s.socket\n%s", unitName, service, unitName, socket)
+		return
+	}
+	dir := userUnitDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fail("%v", err)
+	}
+	for name, content := range map[string]string{
+		unitName + ".service": service,
+		unitName + ".socket":  socket,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			fail("%v", err)
+		}
+		fmt.Printf("Wrote %s\n", path)
+	}
+	fmt.Printf("Stop any daemon started with `pty-daemon start`, then enable with:\n"+
+		"  systemctl --user daemon-reload\n"+
+		"  systemctl --user enable --now %s.socket\n", unitName)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListenFDs(t *testing.T) {
+	self := strconv.Itoa(os.Getpid())
+	cases := []struct {
+		pid, fds string
+		want     int
+		wantErr  bool
+	}{
+		{"", "", 0, false},
+		{self, "1", 1, false},
+		{"1", "1", 0, false}, // meant for another process
+		{self, "x", 0, true},
+	}
+	for _, c := range cases {
+		n, err := listenFDs(c.pid, c.fds)
+		if n != c.want || (err != nil) != c.wantErr {
+			t.Errorf("listenFDs(%q, %q) = %d, %v", c.pid, c.fds, n, err)
+		}
+	}
+}
+
+func TestSdNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if err := sdNotify("READY=1"); err != nil {
+		t.Fatalf("no NOTIFY_SOCKET should be a no-op, got %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", path)
+	if err := sdNotify("READY=1"); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(buf[:n]); got != "READY=1" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", "")
+	if got := watchdogInterval(); got != 15*time.Second {
+		t.Fatalf("expected half of 30s, got %v", got)
+	}
+	t.Setenv("WATCHDOG_PID", "1")
+	if got := watchdogInterval(); got != 0 {
+		t.Fatalf("watchdog for another pid should be off, got %v", got)
+	}
+}
+
+func TestRenderUnits(t *testing.T) {
+	service, socket, err := renderUnits(unitParams{
+		Name:   "pty-daemon",
+		Exe:    "/opt/spaceterm/pty-daemon",
+		Home:   "/home/u/.spaceterm-dev",
+		Socket: "/home/u/.spaceterm-dev/pty-daemon.sock",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Type=notify",
+		"ExecStart=/opt/spaceterm/pty-daemon run",
+		"Environment=SPACETERM_HOME=/home/u/.spaceterm-dev",
+		"WatchdogSec=",
+	} {
+		if !strings.Contains(service, want) {
+			t.Errorf("service unit missing %q:\n%s", want, service)
+		}
+	}
+	if !strings.Contains(socket, "ListenStream=/home/u/.spaceterm-dev/pty-daemon.sock") {
+		t.Errorf("socket unit has wrong path:\n%s", socket)
+	}
+	if !strings.Contains(socket, "SocketMode=0600\n") {
+		t.Errorf("socket should be owner-only by default:\n%s", socket)
+	}
+	if _, socket, _ = renderUnits(unitParams{Name: "pty-daemon", Exe: "/x", Shared: true}); !strings.Contains(socket, "SocketMode=0666\nDirectoryMode=0711\n") {
+		t.Errorf("allowed uids should open the socket up:\n%s", socket)
+	}
+
+	service, _, _ = renderUnits(unitParams{Name: "pty-daemon", Exe: "/x"})
+	if strings.Contains(service, "Environment=") {
+		t.Errorf("no home should mean no Environment line:\n%s", service)
+	}
+}
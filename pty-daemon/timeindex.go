@@ -0,0 +1,105 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// Time index granularity. A new mark is made for output written at least
+// timeMarkEvery after the last, and when a ring holds more than
+// maxTimeMarks, every other one is dropped, so a quiet session's index
+// gets coarser rather than bigger.
+const (
+	timeMarkEvery = time.Second
+	maxTimeMarks  = 4096
+)
+
+// stamp notes that output from offset on was written at now. Caller holds
+// r.mu.
+func (r *RingBuffer) stamp(offset uint64, now time.Time) {
+	ms := now.UnixMilli()
+	if n := len(r.times); n > 0 && ms-r.times[n-1].At < timeMarkEvery.Milliseconds() {
+		return
+	}
+	r.times = append(r.times, TimeMark{Offset: offset, At: ms})
+	if len(r.times) > maxTimeMarks {
+		kept := r.times[:0]
+		for i, m := range r.times {
+			if i%2 == 0 || i == len(r.times)-1 {
+				kept = append(kept, m)
+			}
+		}
+		r.times = kept
+	}
+}
+
+// pruneTimes drops marks for output no longer held, keeping the one that
+// covers the oldest byte. Caller holds r.mu.
+func (r *RingBuffer) pruneTimes() {
+	if !r.full {
+		return
+	}
+	oldest := r.total - uint64(r.size)
+	i := 0
+	for i+1 < len(r.times) && r.times[i+1].Offset <= oldest {
+		i++
+	}
+	r.times = r.times[i:]
+}
+
+// TimeIndex returns a copy of the ring's time marks, oldest first: output
+// from each mark's offset up to the next was written within a second or
+// so of its time.
+func (r *RingBuffer) TimeIndex() []TimeMark {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]TimeMark(nil), r.times...)
+}
+
+// timeOf returns when the output at offset was written, in unix ms, or 0
+// if it predates the index.
+func timeOf(index []TimeMark, offset uint64) int64 {
+	i := sort.Search(len(index), func(i int) bool { return index[i].Offset > offset })
+	if i == 0 {
+		return 0
+	}
+	return index[i-1].At
+}
+
+// offsetAt returns where output written at or after t (unix ms) begins,
+// rounding out to the mark that covers t.
+func offsetAt(index []TimeMark, t int64) uint64 {
+	i := sort.Search(len(index), func(i int) bool { return index[i].At > t })
+	if i == 0 {
+		if len(index) == 0 {
+			return 0
+		}
+		return index[0].Offset
+	}
+	return index[i-1].Offset
+}
+
+// offsetAfter returns where output written after t (unix ms) begins, or
+// end if there is none.
+func offsetAfter(index []TimeMark, t int64, end uint64) uint64 {
+	i := sort.Search(len(index), func(i int) bool { return index[i].At > t })
+	if i == len(index) {
+		return end
+	}
+	return index[i].Offset
+}
+
+// resolve turns a range into stream offsets within [start, end).
+func (r OutputRange) resolve(index []TimeMark, start, end uint64) (uint64, uint64) {
+	from, to := max(r.From, start), end
+	if r.To != 0 {
+		to = min(r.To, end)
+	}
+	if r.Since != 0 {
+		from = max(from, offsetAt(index, r.Since))
+	}
+	if r.Until != 0 {
+		to = min(to, offsetAfter(index, r.Until, end))
+	}
+	return from, max(from, to)
+}
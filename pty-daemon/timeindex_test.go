@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRingBuffer_StampsOncePerSecond(t *testing.T) {
+	r := NewRingBuffer(1024)
+	t0 := time.UnixMilli(1_000_000)
+	r.writeAt([]byte("aa"), t0)
+	r.writeAt([]byte("bb"), t0.Add(500*time.Millisecond))
+	r.writeAt([]byte("cc"), t0.Add(1500*time.Millisecond))
+	r.writeAt(nil, t0.Add(5*time.Second))
+	got := r.TimeIndex()
+	want := []TimeMark{{0, 1_000_000}, {4, 1_001_500}}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestRingBuffer_TimeIndexThinsAndPrunes(t *testing.T) {
+	r := NewRingBuffer(1 << 20)
+	t0 := time.UnixMilli(0)
+	for i := 0; i <= maxTimeMarks; i++ {
+		r.writeAt([]byte("x"), t0.Add(time.Duration(i)*time.Second))
+	}
+	index := r.TimeIndex()
+	if len(index) > maxTimeMarks/2+1 || index[len(index)-1].Offset != maxTimeMarks {
+		t.Fatalf("expected a thinned index ending at the last write, got %d marks", len(index))
+	}
+
+	// Once the ring wraps, marks for evicted output go, but the one
+	// covering the oldest byte stays.
+	r = NewRingBuffer(10)
+	r.writeAt([]byte("0123456789"), t0)
+	r.writeAt([]byte("abcde"), t0.Add(2*time.Second))
+	r.writeAt([]byte("fgh"), t0.Add(4*time.Second))
+	index = r.TimeIndex()
+	if len(index) != 3 || timeOf(index, 5) != 0 {
+		t.Fatalf("expected all marks kept, got %v", index)
+	}
+	r.writeAt([]byte("ijklmnop"), t0.Add(6*time.Second))
+	index = r.TimeIndex()
+	if len(index) != 2 || index[0].Offset != 15 {
+		t.Fatalf("expected the marks from the one covering offset 16, got %v", index)
+	}
+}
+
+func TestOutputRange_Resolve(t *testing.T) {
+	index := []TimeMark{{100, 1000}, {200, 3000}, {300, 5000}}
+	cases := []struct {
+		r        OutputRange
+		from, to uint64
+	}{
+		{OutputRange{}, 50, 400},
+		{OutputRange{From: 120, To: 250}, 120, 250},
+		{OutputRange{From: 10, To: 900}, 50, 400},
+		{OutputRange{Since: 3500}, 200, 400},
+		{OutputRange{Since: 3000, Until: 4000}, 200, 300},
+		{OutputRange{Until: 500}, 50, 100},
+		{OutputRange{Since: 9000}, 300, 400},
+		{OutputRange{From: 350, Until: 2000}, 350, 350},
+	}
+	for _, c := range cases {
+		from, to := c.r.resolve(index, 50, 400)
+		if from != c.from || to != c.to {
+			t.Errorf("%+v: got %d–%d, want %d–%d", c.r, from, to, c.from, c.to)
+		}
+	}
+	if got := timeOf(index, 250); got != 3000 {
+		t.Errorf("expected offset 250 at 3000, got %d", got)
+	}
+}
+
+func TestParseWhen(t *testing.T) {
+	now := time.Date(2026, 3, 4, 15, 30, 0, 0, time.UTC)
+	cases := map[string]time.Time{
+		"2026-03-01T10:00:00Z": time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC),
+		"09:15":                time.Date(2026, 3, 4, 9, 15, 0, 0, time.UTC),
+		"09:15:30":             time.Date(2026, 3, 4, 9, 15, 30, 0, time.UTC),
+		"5m":                   now.Add(-5 * time.Minute),
+		"-1h":                  now.Add(-time.Hour),
+	}
+	for in, want := range cases {
+		got, err := parseWhen(in, now)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("%q: got %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if _, err := parseWhen("yesterday", now); err == nil {
+		t.Error("expected an error for an unreadable time")
+	}
+}